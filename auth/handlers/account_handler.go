@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EmailRequest represents a request that names an email address
+// @Description Email address payload
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// VerifyEmailRequest represents the request body for verifying an email address
+// @Description Email verification payload
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResetPasswordRequest represents the request body for a password reset
+// @Description Password reset payload
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=3"`
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Verify the address a verification link was mailed to
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} models.LogoutResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/email/verify [post]
+func (h *AuthHandler) VerifyEmail(c echo.Context) error {
+	var req VerifyEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	err := h.accountSvc.VerifyEmail(req.Token)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not verify email"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Mail a new verification link. The response is the same whether or not the address is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body EmailRequest true "Email address"
+// @Success 202 {object} models.LogoutResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/email/verify/resend [post]
+func (h *AuthHandler) ResendVerification(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.accountSvc.ResendVerification(req.Email); err != nil {
+		c.Logger().Errorf("failed to resend verification email: %v", err)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "if the address needs verifying, a link is on its way"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mail a password reset link. The response is the same whether or not the address is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body EmailRequest true "Email address"
+// @Success 202 {object} models.LogoutResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.accountSvc.ForgotPassword(req.Email); err != nil {
+		c.Logger().Errorf("failed to send password reset email: %v", err)
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "if the address is registered, a reset link is on its way"})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password with a reset token. Every session of the user is logged out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.LogoutResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/password/reset [post]
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	err := h.accountSvc.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not reset password"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "password reset, please log in again"})
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminHandler handles user management for admins and support staff
+type AdminHandler struct {
+	authSvc *services.AuthService
+	tierSvc *services.TierService
+}
+
+// SetRoleRequest represents the request body for changing a user's role
+// @Description Role change request payload
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// SetTierRequest represents the request body for changing a user's tier
+// @Description Tier change request payload
+type SetTierRequest struct {
+	Tier   string `json:"tier" validate:"required"`
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+func NewAdminHandler(authSvc *services.AuthService, tierSvc *services.TierService) *AdminHandler {
+	return &AdminHandler{
+		authSvc: authSvc,
+		tierSvc: tierSvc,
+	}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List users, optionally filtered by email and role
+// @Tags admin
+// @Produce json
+// @Param email query string false "Email contains"
+// @Param role query string false "Role"
+// @Param limit query int false "Page size"
+// @Param offset query int false "Offset"
+// @Success 200 {array} models.UserResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/users [get]
+func (h *AdminHandler) ListUsers(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+
+	users, err := h.authSvc.ListUsers(c.QueryParam("email"), c.QueryParam("role"), limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not fetch users"})
+	}
+
+	response := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, models.NewUserResponse(&user))
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Get a single user by id
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/admin/users/{id} [get]
+func (h *AdminHandler) GetUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	user, err := h.authSvc.GetUser(userID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not fetch user"})
+	}
+
+	return c.JSON(http.StatusOK, models.NewUserResponse(user))
+}
+
+// SetRole godoc
+// @Summary Change a user's role
+// @Description Change a user's role; the user is logged out of every session
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetRoleRequest true "New role"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/role [put]
+func (h *AdminHandler) SetRole(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	var req SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, err := h.authSvc.SetRole(userID, req.Role)
+	switch {
+	case errors.Is(err, services.ErrInvalidRole):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, services.ErrLastAdmin):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not change role"})
+	}
+
+	return c.JSON(http.StatusOK, models.NewUserResponse(user))
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user
+// @Description Lift a lockout caused by failed logins and clear the user's failure count
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	user, err := h.authSvc.UnlockUser(userID)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, services.ErrRedisUnavailable):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "session store unavailable"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not unlock user"})
+	}
+
+	return c.JSON(http.StatusOK, models.NewUserResponse(user))
+}
+
+// SetTier godoc
+// @Summary Change a user's tier
+// @Description Move a user to another tier without charging them
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetTierRequest true "New tier"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/tier [put]
+func (h *AdminHandler) SetTier(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	var req SetTierRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, err := h.tierSvc.ChangeTier(userID, cc.UserID, req.Tier, req.Reason, false)
+	if err != nil {
+		return tierError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.NewUserResponse(user))
+}
+
+// GetTierHistory godoc
+// @Summary List a user's tier changes
+// @Description List a user's tier changes, newest first
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param limit query int false "Page size"
+// @Success 200 {array} models.TierChange
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/tiers [get]
+func (h *AdminHandler) GetTierHistory(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	changes, err := h.tierSvc.History(userID, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not fetch tier history"})
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyHandler manages API keys for server-to-server clients
+type APIKeyHandler struct {
+	apiKeySvc *services.APIKeyService
+}
+
+// CreateAPIKeyRequest represents the request body for issuing an API key
+// @Description API key request payload
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func NewAPIKeyHandler(apiKeySvc *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeySvc: apiKeySvc,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Issue an API key for the current user. The key is only shown in this response.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} models.APIKeyCreatedResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	return h.create(c, cc.UserID, cc.UserID)
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the current user's API keys, including revoked ones
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	return h.list(c, cc.UserID)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys
+// @Tags api-keys
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	return h.revoke(c, cc.UserID, c.Param("id"))
+}
+
+// CreateUserAPIKey godoc
+// @Summary Create an API key for a user
+// @Description Issue an API key owned by another user, e.g. a partner organization's account
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} models.APIKeyCreatedResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/keys [post]
+func (h *APIKeyHandler) CreateUserAPIKey(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	return h.create(c, userID, cc.UserID)
+}
+
+// ListUserAPIKeys godoc
+// @Summary List a user's API keys
+// @Description List the API keys owned by a user, including revoked ones
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} models.APIKey
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/keys [get]
+func (h *APIKeyHandler) ListUserAPIKeys(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	return h.list(c, userID)
+}
+
+// RevokeUserAPIKey godoc
+// @Summary Revoke a user's API key
+// @Description Revoke an API key owned by a user
+// @Tags admin
+// @Param id path string true "User ID"
+// @Param key_id path string true "API key ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/keys/{key_id} [delete]
+func (h *APIKeyHandler) RevokeUserAPIKey(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+	}
+
+	return h.revoke(c, userID, c.Param("key_id"))
+}
+
+func (h *APIKeyHandler) create(c echo.Context, userID, actorID uuid.UUID) error {
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	key, secret, err := h.apiKeySvc.Create(userID, actorID, req.Name, req.Scopes, req.ExpiresAt)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case err != nil:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, models.APIKeyCreatedResponse{APIKey: *key, Key: secret})
+}
+
+func (h *APIKeyHandler) list(c echo.Context, userID uuid.UUID) error {
+	keys, err := h.apiKeySvc.List(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not fetch api keys"})
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) revoke(c echo.Context, userID uuid.UUID, id string) error {
+	keyID, err := uuid.Parse(id)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid api key id"})
+	}
+
+	err = h.apiKeySvc.Revoke(userID, keyID)
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "api key not found"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not revoke api key"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/interfaces"
 	"github.com/nazrawigedion123/wallet-backend/auth/models"
 
 	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
 	"github.com/nazrawigedion123/wallet-backend/auth/services"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 	"github.com/nazrawigedion123/wallet-backend/utils"
 
 	"github.com/labstack/echo/v4"
@@ -15,8 +20,11 @@ import (
 
 // AuthHandler handles authentication related requests
 type AuthHandler struct {
-	authSvc    *services.AuthService
-	sessionSvc *services.SessionService
+	authSvc      *services.AuthService
+	sessionSvc   *services.SessionService
+	twoFactorSvc *services.TwoFactorService
+	accountSvc   *services.AccountService
+	tierSvc      *services.TierService
 }
 
 // RegisterRequest represents the request body for registration
@@ -26,29 +34,41 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required,min=3"`
 }
 
-// TierUpgrade represents the request body for tier upgrade
-// @Description Tier upgrade request payload
+// TierUpgrade represents the request body for a tier change
+// @Description Tier change request payload
 type TierUpgrade struct {
+	// Tier is one of basic, premium or enterprise.
 	Tier string `json:"tier" validate:"required"`
 }
 
+// RefreshRequest represents the request body for a token refresh
+// @Description Token refresh request payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 // LoginRequest represents the request body for login
 // @Description Login request payload
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// DeviceLabel is an optional name shown in the session list, e.g. "Work laptop".
+	DeviceLabel string `json:"device_label" validate:"max=64"`
 }
 
-func NewAuthHandler(authSvc *services.AuthService, sessionSvc *services.SessionService) *AuthHandler {
+func NewAuthHandler(authSvc *services.AuthService, sessionSvc *services.SessionService, twoFactorSvc *services.TwoFactorService, accountSvc *services.AccountService, tierSvc *services.TierService) *AuthHandler {
 	return &AuthHandler{
-		authSvc:    authSvc,
-		sessionSvc: sessionSvc,
+		authSvc:      authSvc,
+		sessionSvc:   sessionSvc,
+		twoFactorSvc: twoFactorSvc,
+		accountSvc:   accountSvc,
+		tierSvc:      tierSvc,
 	}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user account
+// @Description Register a new user account. A verification link is mailed to the address; login is refused until it is followed.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -72,6 +92,11 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "registration failed"})
 	}
 
+	if err := h.accountSvc.SendVerification(user); err != nil {
+		// The account exists; the user can ask for another link.
+		c.Logger().Errorf("failed to send verification email: %v", err)
+	}
+
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"id":    user.ID,
 		"email": user.Email,
@@ -81,13 +106,16 @@ func (h *AuthHandler) Register(c echo.Context) error {
 
 // Login godoc
 // @Summary Login a new user
-// @Description Login a new user account
+// @Description Login a new user account. Users with two-factor enabled get a challenge to finish at /api/login/2fa instead of tokens.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "Registration details"
 // @Success 201 {object} models.LoginResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/login [post]
 func (h *AuthHandler) Login(c echo.Context) error {
@@ -100,23 +128,92 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	ipAddress := c.RealIP()
+	client := models.ClientInfo{
+		IPAddress:   c.RealIP(),
+		UserAgent:   c.Request().UserAgent(),
+		DeviceLabel: req.DeviceLabel,
+	}
 
-	token, user, err := h.authSvc.Login(req.Email, req.Password, ipAddress)
+	result, err := h.authSvc.Login(req.Email, req.Password, client)
+	var blocked *services.LoginBlockedError
+	if errors.As(err, &blocked) {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": blocked.Error()})
+	}
+	if errors.Is(err, services.ErrRedisUnavailable) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "session store unavailable"})
+	}
+	if errors.Is(err, services.ErrEmailNotVerified) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 	}
 
+	if result.Challenge != nil {
+		return c.JSON(http.StatusAccepted, models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeID:       result.Challenge.ChallengeID,
+			ExpiresAt:         result.Challenge.ExpiresAt,
+		})
+	}
+
+	return loginResponse(c, result)
+}
+
+// loginResponse writes the tokens and user of a finished login.
+func loginResponse(c echo.Context, result *models.LoginResult) error {
+	tokens, user := result.Tokens, result.User
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"token_type":         tokens.TokenType,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_in": tokens.RefreshExpiresIn,
 		"user": map[string]interface{}{
 			"id":    user.ID,
 			"email": user.Email,
 			"tier":  user.Tier,
+			"role":  user.Role,
 		},
 	})
 }
 
+// Refresh godoc
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access and refresh token pair. Reusing a refresh token revokes its session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/token/refresh [post]
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	tokens, err := h.sessionSvc.Refresh(req.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	if errors.Is(err, services.ErrRedisUnavailable) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "session store unavailable"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
 // Logout godoc
 // @Summary Logout a new user
 // @Description Logout a new user account
@@ -134,7 +231,7 @@ func (h *AuthHandler) Logout(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
 	}
 
-	err := h.sessionSvc.InvalidateSession(cc.SessionToken)
+	err := h.sessionSvc.InvalidateSession(cc.SessionID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "logout failed"})
 	}
@@ -176,53 +273,85 @@ func (h *AuthHandler) Profile(c echo.Context) error {
 		"id":    user.ID,
 		"email": user.Email,
 		"tier":  user.Tier,
+		"role":  user.Role,
+		// Permissions reflect the stored role, which may be newer than the session's.
+		"permissions": user.Role.Permissions(),
 	})
 }
 
 // TierUpgrade godoc
-// @Summary TierUpgrade a new user
-// @Description TierUpgrade a new user account
+// @Summary Change the current user's tier
+// @Description Move to another tier. Upgrades are paid from the user's USD wallet and only offered for tiers with a configured price; downgrades are free. Live sessions pick up the new tier immediately.
 // @Tags auth
 // @Accept json
 // @Produce json
-
-// @Success 201 {object} models.TierUpgradeResponse
+// @Param request body TierUpgrade true "Target tier"
+// @Success 200 {object} models.UserResponse
 // @Failure 400 {object} models.ErrorResponse
-// @Failure 500 {object} models.ErrorResponse
+// @Failure 402 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Router /api/tiers/upgrade [post]
 func (h *AuthHandler) TierUpgrade(c echo.Context) error {
-
-	userIDVal := c.Get("userID")
-
-	if userIDVal == nil {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
 	}
 
-	userID, ok := userIDVal.(uuid.UUID)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid user id type"})
-	}
-	var tier TierUpgrade
-	if err := c.Bind(&tier); err != nil {
+	var req TierUpgrade
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	var user models.User
-	if err := utils.DB.First(&user, userID).Error; err != nil {
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	user, err := h.tierSvc.ChangeTier(cc.UserID, cc.UserID, req.Tier, "self-service", true)
+	if err != nil {
+		return tierError(c, err)
 	}
-	if tier.Tier == "Premium" || tier.Tier == "Enterprise" || tier.Tier == "Basic" {
-		user.Tier = tier.Tier
 
-	} else {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid Tier"})
+	return c.JSON(http.StatusOK, models.NewUserResponse(user))
+}
 
+// TierHistory godoc
+// @Summary List the current user's tier changes
+// @Description List the current user's tier changes, newest first
+// @Tags auth
+// @Produce json
+// @Param limit query int false "Page size"
+// @Success 200 {array} models.TierChange
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/tiers/history [get]
+func (h *AuthHandler) TierHistory(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"id":    user.ID,
-		"email": user.Email,
-		"tier":  user.Tier,
-	})
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	changes, err := h.tierSvc.History(cc.UserID, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not fetch tier history"})
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
+
+func tierError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, tier.ErrInvalidTier):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, services.ErrTierUnchanged), errors.Is(err, services.ErrTierConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, interfaces.ErrPaymentDeclined):
+		return c.JSON(http.StatusPaymentRequired, map[string]string{"error": err.Error()})
+	case errors.Is(err, interfaces.ErrTierNotForSale):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not change tier"})
+	}
 }
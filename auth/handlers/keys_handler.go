@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/nazrawigedion123/wallet-backend/auth/keyring"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeysHandler publishes the public keys that verify our tokens
+type KeysHandler struct {
+	keys *keyring.KeyRing
+}
+
+func NewKeysHandler(keys *keyring.KeyRing) *KeysHandler {
+	return &KeysHandler{
+		keys: keys,
+	}
+}
+
+// JWKS godoc
+// @Summary Token signing keys
+// @Description Public keys that verify access and refresh tokens, as a JSON Web Key Set. Keys are matched to tokens by their kid header; fetch the set again when a token names an unknown kid.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwk.Set
+// @Router /.well-known/jwks.json [get]
+func (h *KeysHandler) JWKS(c echo.Context) error {
+	// Short enough that a rotated key is picked up quickly by caches that
+	// do not refetch on an unknown kid.
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/oidc"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OIDCHandler handles single sign-on through an OpenID provider
+type OIDCHandler struct {
+	oidcSvc *services.OIDCService
+}
+
+func NewOIDCHandler(oidcSvc *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcSvc: oidcSvc,
+	}
+}
+
+// Login godoc
+// @Summary Start single sign-on
+// @Description Redirect to the identity provider to sign in
+// @Tags auth
+// @Param device_label query string false "Label for the new session"
+// @Success 302
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/oidc/login [get]
+func (h *OIDCHandler) Login(c echo.Context) error {
+	authURL, err := h.oidcSvc.Begin(c.QueryParam("device_label"))
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "could not start sign-in"})
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary Finish single sign-on
+// @Description Exchange the identity provider's code for a session. Users with two-factor enabled get a challenge to complete at /api/login/2fa.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the sign-in request"
+// @Success 200 {object} models.LoginResponse
+// @Success 202 {object} models.TwoFactorChallengeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /api/oidc/callback [get]
+func (h *OIDCHandler) Callback(c echo.Context) error {
+	if providerErr := c.QueryParam("error"); providerErr != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "sign-in was refused: " + providerErr})
+	}
+	if c.QueryParam("code") == "" || c.QueryParam("state") == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code and state are required"})
+	}
+
+	client := models.ClientInfo{
+		IPAddress: c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+	result, err := h.oidcSvc.Complete(c.Request().Context(), c.QueryParam("state"), c.QueryParam("code"), client)
+	switch {
+	case errors.Is(err, services.ErrInvalidOIDCState):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, oidc.ErrExchangeFailed), errors.Is(err, oidc.ErrInvalidIDToken):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "single sign-on failed"})
+	case errors.Is(err, services.ErrOIDCEmailNotVerified), errors.Is(err, services.ErrOIDCAccountNotFound),
+		errors.Is(err, services.ErrOIDCAccountUnverified):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrRedisUnavailable):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "session store unavailable"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not sign in"})
+	}
+
+	if result.Challenge != nil {
+		return c.JSON(http.StatusAccepted, models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeID:       result.Challenge.ChallengeID,
+			ExpiresAt:         result.Challenge.ExpiresAt,
+		})
+	}
+
+	return loginResponse(c, result)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List every live session of the current user
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.SessionResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/sessions [get]
+func (h *AuthHandler) ListSessions(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	sessions, err := h.sessionSvc.ListSessions(cc.UserID)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "could not list sessions"})
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, models.SessionResponse{
+			ID:          session.SessionID,
+			IPAddress:   session.IPAddress,
+			UserAgent:   session.UserAgent,
+			DeviceLabel: session.DeviceLabel,
+			LastLogin:   session.LastLogin,
+			Current:     session.SessionID == cc.SessionID,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one of the current user's sessions
+// @Tags auth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.LogoutResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	err := h.sessionSvc.RevokeSession(cc.UserID, c.Param("id"))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not revoke session"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "session revoked"})
+}
+
+// RevokeAllSessions godoc
+// @Summary Log out everywhere
+// @Description Revoke every session of the current user, or every other session with except_current=true
+// @Tags auth
+// @Produce json
+// @Param except_current query bool false "Keep the session making this request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/sessions [delete]
+func (h *AuthHandler) RevokeAllSessions(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	keep := ""
+	if exceptCurrent, _ := strconv.ParseBool(c.QueryParam("except_current")); exceptCurrent {
+		keep = cc.SessionID
+	}
+
+	revoked, err := h.sessionSvc.RevokeAllSessions(cc.UserID, keep)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not revoke sessions"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "sessions revoked",
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TwoFactorLoginRequest represents the request body for finishing a login
+// @Description Second-factor login payload
+type TwoFactorLoginRequest struct {
+	ChallengeID string `json:"challenge_id" validate:"required"`
+	// Code is a 6-digit TOTP code or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+// TwoFactorCodeRequest represents a request confirmed with a current code
+// @Description Two-factor code payload
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// LoginTwoFactor godoc
+// @Summary Finish a two-factor login
+// @Description Exchange a login challenge and a TOTP or recovery code for tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge and code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/login/2fa [post]
+func (h *AuthHandler) LoginTwoFactor(c echo.Context) error {
+	var req TwoFactorLoginRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	result, err := h.authSvc.CompleteLogin(req.ChallengeID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return loginResponse(c, result)
+}
+
+// BeginTwoFactor godoc
+// @Summary Start two-factor enrollment
+// @Description Create a TOTP secret to add to an authenticator app. Two-factor stays off until confirmed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/2fa/enroll [post]
+func (h *AuthHandler) BeginTwoFactor(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	enrollment, err := h.twoFactorSvc.BeginEnrollment(cc.UserID)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor godoc
+// @Summary Confirm two-factor enrollment
+// @Description Turn two-factor on with a code from the new secret. The recovery codes are only shown once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/2fa/confirm [post]
+func (h *AuthHandler) ConfirmTwoFactor(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	codes, err := h.twoFactorSvc.ConfirmEnrollment(cc.UserID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Turn off two-factor
+// @Description Turn off two-factor and delete the recovery codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} models.LogoutResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/2fa/disable [post]
+func (h *AuthHandler) DisableTwoFactor(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.twoFactorSvc.Disable(cc.UserID, req.Code); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace recovery codes
+// @Description Invalidate every recovery code and issue new ones
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /api/2fa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	cc := middleware.GetAuthContext(c)
+	if cc == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	codes, err := h.twoFactorSvc.RegenerateRecoveryCodes(cc.UserID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func twoFactorError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrChallengeNotFound):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorLocked):
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrEnrollmentNotFound):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, services.ErrRedisUnavailable):
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "session store unavailable"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "two-factor request failed"})
+	}
+}
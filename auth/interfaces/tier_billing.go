@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+	"gorm.io/gorm"
+)
+
+// ErrPaymentDeclined is wrapped by TierBilling errors when the user cannot
+// pay for an upgrade, e.g. because their wallet balance is too low.
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// ErrTierNotForSale is returned for a self-service upgrade to a tier that
+// has no price. Only an admin can move a user onto such a tier.
+var ErrTierNotForSale = errors.New("tier is not available for self-service upgrade")
+
+// TierBilling charges for paid tier upgrades.
+type TierBilling interface {
+	// ChargeUpgrade bills the user for moving from one tier to another and
+	// calls apply inside the same database transaction with the id of the
+	// charge, or nil if the move is free. If apply fails, nothing is charged.
+	// Upgrades to a tier without a price fail with ErrTierNotForSale.
+	ChargeUpgrade(userID uuid.UUID, from, to tier.Tier, apply func(tx *gorm.DB, transactionID *uint) error) error
+}
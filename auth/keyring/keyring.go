@@ -0,0 +1,395 @@
+// Package keyring holds the asymmetric keys that sign our tokens. One key
+// is active and signs; keys it replaced keep verifying until tokens they
+// signed have expired. Keys live in a Store shared by every instance, so
+// any instance can verify what another signed, and rotate on a schedule.
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nazrawigedion123/wallet-backend/auth/jwk"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+const (
+	// lockTTL bounds how long a crashed instance can block rotation.
+	lockTTL = 30 * time.Second
+	// reloadInterval stops tokens with made-up key ids from turning into a
+	// store read each.
+	reloadInterval = 5 * time.Second
+)
+
+// Algorithm is a JWS algorithm we can sign with.
+type Algorithm string
+
+const (
+	RS256 Algorithm = "RS256"
+	EdDSA Algorithm = "EdDSA"
+)
+
+// ParseAlgorithm reads an algorithm name; empty means RS256.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "", "RS256":
+		return RS256, nil
+	case "EDDSA", "ED25519":
+		return EdDSA, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidAlgorithm, s)
+	}
+}
+
+// Key is one signing key. RetiresAt is nil for the active key; a retiring
+// key only verifies, and is dropped once RetiresAt passes.
+type Key struct {
+	ID        string
+	Algorithm Algorithm
+	CreatedAt time.Time
+	RetiresAt *time.Time
+	signer    crypto.Signer
+}
+
+// Signer is the private key, in the form jwt expects for the algorithm.
+func (k *Key) Signer() crypto.Signer {
+	return k.signer
+}
+
+// Public is the key that verifies the key's signatures.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// Method is the jwt signing method of the key.
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(string(k.Algorithm))
+}
+
+func generateKey(alg Algorithm, now time.Time) (*Key, error) {
+	var signer crypto.Signer
+	switch alg {
+	case RS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	case EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAlgorithm, alg)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:        fmt.Sprintf("%x", id),
+		Algorithm: alg,
+		CreatedAt: now,
+		signer:    signer,
+	}, nil
+}
+
+// storedKey is how a key is kept in the Store.
+type storedKey struct {
+	ID         string     `json:"kid"`
+	Algorithm  Algorithm  `json:"alg"`
+	PrivateKey []byte     `json:"private_key"` // PKCS #8 DER
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiresAt  *time.Time `json:"retires_at,omitempty"`
+}
+
+func encodeKeys(keys []*Key) ([]byte, error) {
+	stored := make([]storedKey, 0, len(keys))
+	for _, k := range keys {
+		der, err := x509.MarshalPKCS8PrivateKey(k.signer)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, storedKey{ID: k.ID, Algorithm: k.Algorithm, PrivateKey: der, CreatedAt: k.CreatedAt, RetiresAt: k.RetiresAt})
+	}
+	return json.Marshal(stored)
+}
+
+func decodeKeys(data []byte) ([]*Key, error) {
+	var stored []storedKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(stored))
+	for _, s := range stored {
+		private, err := x509.ParsePKCS8PrivateKey(s.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", s.ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key %s cannot sign", s.ID)
+		}
+		keys = append(keys, &Key{ID: s.ID, Algorithm: s.Algorithm, CreatedAt: s.CreatedAt, RetiresAt: s.RetiresAt, signer: signer})
+	}
+	return keys, nil
+}
+
+// Config says how keys are made and how long they live.
+type Config struct {
+	Algorithm Algorithm
+	// RotationInterval is how long a key signs before a new one takes over.
+	RotationInterval time.Duration
+	// RetireAfter is how long a replaced key keeps verifying. It must be at
+	// least the lifetime of the longest-lived token.
+	RetireAfter time.Duration
+}
+
+// KeyRing signs with the active key and verifies with any live key.
+type KeyRing struct {
+	store  Store
+	config Config
+
+	mu       sync.RWMutex
+	keys     []*Key // active key first
+	loadedAt time.Time
+}
+
+// NewKeyRing loads the keys from store, creating or rotating the active key if
+// there is none or it is due.
+func NewKeyRing(ctx context.Context, store Store, config Config) (*KeyRing, error) {
+	if _, err := ParseAlgorithm(string(config.Algorithm)); err != nil {
+		return nil, err
+	}
+	r := &KeyRing{store: store, config: config}
+
+	// Another instance may be creating the first key; wait for it.
+	deadline := time.Now().Add(lockTTL)
+	for {
+		if err := r.RotateIfDue(ctx); err != nil {
+			return nil, err
+		}
+		if r.Active() != nil {
+			return r, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for a signing key")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Active is the key to sign with.
+func (r *KeyRing) Active() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.keys) == 0 || r.keys[0].RetiresAt != nil {
+		return nil
+	}
+	return r.keys[0]
+}
+
+// Lookup finds a live key by id, reading the store again if the key may
+// have been added by another instance since we last looked.
+func (r *KeyRing) Lookup(ctx context.Context, kid string) (*Key, error) {
+	if key := r.find(kid); key != nil {
+		return key, nil
+	}
+
+	r.mu.RLock()
+	fresh := time.Since(r.loadedAt) < reloadInterval
+	r.mu.RUnlock()
+	if fresh {
+		return nil, ErrUnknownKey
+	}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+	if key := r.find(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (r *KeyRing) find(kid string) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.ID == kid && (k.RetiresAt == nil || now.Before(*k.RetiresAt)) {
+			return k
+		}
+	}
+	return nil
+}
+
+// JWKS is the public half of every live key.
+func (r *KeyRing) JWKS() jwk.Set {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := jwk.Set{Keys: []jwk.Key{}}
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.RetiresAt != nil && !now.Before(*k.RetiresAt) {
+			continue
+		}
+		if key, err := jwk.New(k.ID, string(k.Algorithm), k.Public()); err == nil {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	return set
+}
+
+// LoadedAt is when the keys were last read from the store. Run reads them
+// every interval, so an old value means it has stalled.
+func (r *KeyRing) LoadedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loadedAt
+}
+
+// Reload reads the keys from the store.
+func (r *KeyRing) Reload(ctx context.Context) error {
+	keys, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Rotate makes a new key active. The old active key starts retiring.
+func (r *KeyRing) Rotate(ctx context.Context) error {
+	return r.rotate(ctx, true)
+}
+
+// RotateIfDue rotates when there is no active key or it has signed for
+// RotationInterval. Only one instance rotates; the rest pick up its key.
+func (r *KeyRing) RotateIfDue(ctx context.Context) error {
+	return r.rotate(ctx, false)
+}
+
+func (r *KeyRing) rotate(ctx context.Context, force bool) error {
+	if !force {
+		if err := r.Reload(ctx); err != nil {
+			return err
+		}
+		if !r.due() {
+			return nil
+		}
+	}
+
+	release, ok, err := r.store.Lock(ctx, lockTTL)
+	if err != nil {
+		return fmt.Errorf("failed to lock key ring: %v", err)
+	}
+	if !ok {
+		// Another instance is rotating; Run or Lookup will pick it up.
+		return nil
+	}
+	defer release()
+
+	// Read again under the lock in case another instance just rotated.
+	if err := r.Reload(ctx); err != nil {
+		return err
+	}
+	if !force && !r.due() {
+		return nil
+	}
+
+	now := time.Now()
+	key, err := generateKey(r.config.Algorithm, now)
+	if err != nil {
+		return err
+	}
+	retiresAt := now.Add(r.config.RetireAfter)
+
+	r.mu.RLock()
+	keys := []*Key{key}
+	for _, k := range r.keys {
+		if k.RetiresAt == nil {
+			retiring := *k
+			retiring.RetiresAt = &retiresAt
+			keys = append(keys, &retiring)
+		} else if now.Before(*k.RetiresAt) {
+			keys = append(keys, k)
+		}
+	}
+	r.mu.RUnlock()
+
+	data, err := encodeKeys(keys)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Save(ctx, data); err != nil {
+		return fmt.Errorf("failed to save key ring: %v", err)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.loadedAt = now
+	r.mu.Unlock()
+	log.Printf("Rotated token signing key, %s (%s) is now active", key.ID, key.Algorithm)
+	return nil
+}
+
+// due reports whether the active key should be replaced.
+func (r *KeyRing) due() bool {
+	active := r.Active()
+	return active == nil ||
+		active.Algorithm != r.config.Algorithm ||
+		(r.config.RotationInterval > 0 && time.Since(active.CreatedAt) >= r.config.RotationInterval)
+}
+
+func (r *KeyRing) load(ctx context.Context) ([]*Key, error) {
+	data, err := r.store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key ring: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return decodeKeys(data)
+}
+
+// Run keeps the ring in sync with the store and rotates on schedule until
+// ctx is done.
+func (r *KeyRing) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.RotateIfDue(ctx); err != nil {
+				log.Printf("Key ring refresh failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package keyring
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps the encoded key ring where every instance can read it.
+type Store interface {
+	// Load returns the saved ring, or nil if nothing has been saved.
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, data []byte) error
+	// Lock takes an exclusive lock for up to ttl. ok is false if someone
+	// else holds it.
+	Lock(ctx context.Context, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// releaseLockScript deletes the lock only if we still hold it.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps the ring under a single Redis key. The private keys are
+// stored as they are, so the Redis instance must be trusted with them.
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisStore(client *redis.Client, key string) *RedisStore {
+	return &RedisStore{client: client, key: key}
+}
+
+func (s *RedisStore) Load(ctx context.Context) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *RedisStore) Save(ctx context.Context, data []byte) error {
+	return s.client.Set(ctx, s.key, data, 0).Err()
+}
+
+func (s *RedisStore) Lock(ctx context.Context, ttl time.Duration) (func(), bool, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, false, err
+	}
+	token := hex.EncodeToString(raw)
+	lockKey := s.key + ":lock"
+
+	ok, err := s.client.SetNX(ctx, lockKey, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		releaseLockScript.Run(context.Background(), s.client, []string{lockKey}, token)
+	}, true, nil
+}
+
+// MemoryStore keeps the ring in process, for a single instance.
+type MemoryStore struct {
+	mu     sync.Mutex
+	data   []byte
+	locked bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, ttl time.Duration) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return nil, false, nil
+	}
+	s.locked = true
+	return func() {
+		s.mu.Lock()
+		s.locked = false
+		s.mu.Unlock()
+	}, true, nil
+}
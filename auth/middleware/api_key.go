@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+)
+
+// APIKeyHeader carries an API key in place of a bearer session.
+const APIKeyHeader = "X-API-Key"
+
+// AuthOrAPIKey accepts either a bearer session, checked as AuthMiddleware
+// does, or an API key. Both set userID and userTier. Key requests get no
+// role, so staff permissions never apply to them, and their scopes are
+// stored for RequireScope.
+func AuthOrAPIKey(sessionSvc *services.SessionService, apiKeySvc *services.APIKeyService) echo.MiddlewareFunc {
+	sessionAuth := AuthMiddleware(sessionSvc)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withSession := sessionAuth(next)
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(APIKeyHeader)
+			if key == "" {
+				return withSession(c)
+			}
+
+			apiKey, user, err := apiKeySvc.Authenticate(key)
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+			}
+			if err != nil {
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "could not check api key"})
+			}
+
+			c.Set("userID", user.ID)
+			c.Set("userTier", string(user.Tier))
+			c.Set("apiKeyID", apiKey.ID)
+			c.Set("apiKeyScopes", []models.Scope(apiKey.Scopes))
+
+			return next(c)
+		}
+	}
+}
+
+// RequireScope lets API key requests through only if the key was granted
+// scope. Session requests are not scoped. It must run after AuthOrAPIKey.
+func RequireScope(scope models.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, ok := c.Get("apiKeyScopes").([]models.Scope)
+			if !ok {
+				return next(c)
+			}
+			for _, granted := range scopes {
+				if granted == scope {
+					return next(c)
+				}
+			}
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "api key is missing scope " + string(scope)})
+		}
+	}
+}
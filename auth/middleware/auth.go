@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
 	"github.com/nazrawigedion123/wallet-backend/auth/services"
 
 	"github.com/labstack/echo/v4"
@@ -11,9 +13,11 @@ import (
 
 type AuthContext struct {
 	echo.Context
-	UserID       uint
+	UserID       uuid.UUID
 	UserTier     string
+	UserRole     models.Role
 	SessionToken string
+	SessionID    string
 }
 
 func AuthMiddleware(sessionSvc *services.SessionService) echo.MiddlewareFunc {
@@ -38,8 +42,10 @@ func AuthMiddleware(sessionSvc *services.SessionService) echo.MiddlewareFunc {
 
 			// Store in context
 			c.Set("userID", metadata.UserID)
-			c.Set("userTier", metadata.Tier)
+			c.Set("userTier", string(metadata.Tier))
+			c.Set("userRole", metadata.Role)
 			c.Set("sessionToken", tokenString)
+			c.Set("sessionID", metadata.SessionID)
 
 			return next(c)
 		}
@@ -53,7 +59,7 @@ func GetAuthContext(c echo.Context) *AuthContext {
 	userTierValue := c.Get("userTier")
 	sessionTokenValue := c.Get("sessionToken")
 
-	userID, ok1 := userIDValue.(uint)
+	userID, ok1 := userIDValue.(uuid.UUID)
 	userTier, ok2 := userTierValue.(string)
 	sessionToken, ok3 := sessionTokenValue.(string)
 
@@ -61,10 +67,15 @@ func GetAuthContext(c echo.Context) *AuthContext {
 		return nil
 	}
 
+	userRole, _ := c.Get("userRole").(models.Role)
+	sessionID, _ := c.Get("sessionID").(string)
+
 	return &AuthContext{
 		Context:      c,
 		UserID:       userID,
 		UserTier:     userTier,
+		UserRole:     userRole,
 		SessionToken: sessionToken,
+		SessionID:    sessionID,
 	}
 }
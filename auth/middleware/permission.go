@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+)
+
+// RequirePermission lets a request through only if the caller's role grants
+// every listed permission. It must run after AuthMiddleware.
+func RequirePermission(permissions ...models.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("userRole").(models.Role)
+			for _, permission := range permissions {
+				if !role.Can(permission) {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "missing permission " + string(permission)})
+				}
+			}
+			return next(c)
+		}
+	}
+}
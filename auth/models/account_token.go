@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenPurpose says what an AccountToken may be used for.
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail   TokenPurpose = "verify_email"
+	TokenResetPassword TokenPurpose = "reset_password"
+)
+
+// AccountToken is a single-use token mailed to the user. Only a hash of the
+// token is stored, so a database leak cannot be turned into working links.
+type AccountToken struct {
+	ID        uint         `gorm:"primaryKey"`
+	UserID    uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Purpose   TokenPurpose `gorm:"type:varchar(20);not null"`
+	TokenHash string       `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time    `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Scope limits what an API key may do.
+type Scope string
+
+const (
+	ScopeWalletRead  Scope = "wallet:read"
+	ScopeWalletWrite Scope = "wallet:write"
+)
+
+// Scopes lists every scope a key can be given.
+var Scopes = []Scope{ScopeWalletRead, ScopeWalletWrite}
+
+// ParseScope reads a scope name case-insensitively.
+func ParseScope(s string) (Scope, bool) {
+	scope := Scope(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range Scopes {
+		if scope == known {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// APIKey lets a server act as its owner without a session. Partner
+// organizations are given a user of their own to own their keys. Only a
+// hash of the key is stored; Prefix is kept so the key can be recognized in
+// listings.
+type APIKey struct {
+	ID         uuid.UUID                  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID                  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name       string                     `json:"name" gorm:"type:varchar(100);not null"`
+	Prefix     string                     `json:"prefix" gorm:"type:varchar(16);not null"`
+	KeyHash    string                     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Scopes     datatypes.JSONSlice[Scope] `json:"scopes"`
+	CreatedBy  uuid.UUID                  `json:"created_by" gorm:"type:uuid;not null"`
+	ExpiresAt  *time.Time                 `json:"expires_at"`
+	LastUsedAt *time.Time                 `json:"last_used_at"`
+	RevokedAt  *time.Time                 `json:"revoked_at"`
+	CreatedAt  time.Time                  `json:"created_at"`
+}
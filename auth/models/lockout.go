@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LockoutEvent is published when repeated failed logins lock an account or
+// block an IP address. Exactly one of Email and IPAddress is set.
+type LockoutEvent struct {
+	Email     string    `json:"email,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Failures  int64     `json:"failures"`
+	Until     time.Time `json:"until"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCIdentity links a user to their account at an OpenID provider, which
+// is identified by issuer and subject; the email there may change.
+type OIDCIdentity struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_oidc_identities_subject"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_oidc_identities_subject"`
+	Email       string    `gorm:"type:varchar(255)"`
+	LastLoginAt time.Time
+	CreatedAt   time.Time
+}
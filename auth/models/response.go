@@ -1,5 +1,12 @@
 package models
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+)
+
 type RegisterResponse struct {
 	ID    uint   `json:"id"`
 	Email string `json:"email"`
@@ -7,14 +14,28 @@ type RegisterResponse struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  struct {
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	User             struct {
 		ID    uint   `json:"id"`
 		Email string `json:"email"`
 		Tier  string `json:"tier"`
 	} `json:"user"`
 }
 
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeID       string    `json:"challenge_id"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 type LogoutResponse struct {
 	Message string `json:"message"`
 }
@@ -34,3 +55,36 @@ type TierUpgradeResponse struct {
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
+
+type UserResponse struct {
+	ID          uuid.UUID    `json:"id"`
+	Email       string       `json:"email"`
+	Tier        tier.Tier    `json:"tier"`
+	Role        Role         `json:"role"`
+	Permissions []Permission `json:"permissions"`
+}
+
+func NewUserResponse(user *User) UserResponse {
+	return UserResponse{
+		ID:          user.ID,
+		Email:       user.Email,
+		Tier:        user.Tier,
+		Role:        user.Role,
+		Permissions: user.Role.Permissions(),
+	}
+}
+
+type SessionResponse struct {
+	ID          string    `json:"id"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	DeviceLabel string    `json:"device_label"`
+	LastLogin   time.Time `json:"last_login"`
+	Current     bool      `json:"current"`
+}
+
+// APIKeyCreatedResponse carries the key itself, which is shown only once.
+type APIKeyCreatedResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "strings"
+
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAuditor Role = "auditor"
+	RoleAdmin   Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermViewUsers     Permission = "users:read"
+	PermManageUsers   Permission = "users:manage"
+	PermViewFees      Permission = "fees:read"
+	PermManageFees    Permission = "fees:manage"
+	PermViewLimits    Permission = "limits:read"
+	PermManageLimits  Permission = "limits:manage"
+	PermViewKYC       Permission = "kyc:read"
+	PermReviewKYC     Permission = "kyc:review"
+	PermRunSimulation Permission = "simulation:run"
+)
+
+// rolePermissions lists what each role may do beyond using its own wallet.
+var rolePermissions = map[Role][]Permission{
+	RoleUser:    {},
+	RoleSupport: {PermViewUsers, PermViewFees, PermViewLimits, PermViewKYC},
+	RoleAuditor: {PermViewUsers, PermViewFees, PermViewLimits, PermViewKYC},
+	RoleAdmin:   {PermViewUsers, PermManageUsers, PermViewFees, PermManageFees, PermViewLimits, PermManageLimits, PermViewKYC, PermReviewKYC, PermRunSimulation},
+}
+
+// ParseRole reads a role name case-insensitively.
+func ParseRole(s string) (Role, bool) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// Can reports whether the role grants permission. Unknown roles grant nothing.
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Role) Permissions() []Permission {
+	return rolePermissions[r]
+}
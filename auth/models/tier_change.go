@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+)
+
+// TierChange records one move of a user between tiers.
+type TierChange struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	FromTier tier.Tier `json:"from_tier" gorm:"type:varchar(20);not null"`
+	ToTier   tier.Tier `json:"to_tier" gorm:"type:varchar(20);not null"`
+	// ActorID is who made the change: the user themselves or an admin.
+	ActorID uuid.UUID `json:"actor_id" gorm:"type:uuid;not null"`
+	Reason  string    `json:"reason,omitempty"`
+	// TransactionID is the wallet transaction that paid for the upgrade.
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// user has lost their authenticator. Only a hash is stored.
+type RecoveryCode struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"type:varchar(64);not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginChallenge is handed back instead of tokens when the password was
+// right but a second factor is still needed.
+type LoginChallenge struct {
+	ChallengeID string    `json:"challenge_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// LoginResult carries either a new session or a challenge to complete first.
+type LoginResult struct {
+	Tokens    *TokenPair
+	User      *User
+	Challenge *LoginChallenge
+}
+
+// TOTPEnrollment is what the user scans into their authenticator app.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
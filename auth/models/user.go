@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 )
 
 type User struct {
@@ -11,13 +12,44 @@ type User struct {
 	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
 	Email    string    `gorm:"unique;not null"`
 	Password string    `gorm:"not null"`
-	Tier     string    `gorm:"default:'basic'"`
+	Tier     tier.Tier `gorm:"type:varchar(20);not null;default:'basic'"`
+	Role     Role      `gorm:"type:varchar(20);not null;default:'user'"`
+	// EmailVerifiedAt is set once the user follows the link mailed at sign-up.
+	EmailVerifiedAt *time.Time
+
+	// TOTPSecret is only set once enrollment has been confirmed.
+	TOTPSecret  string `gorm:"type:varchar(64)"`
+	TOTPEnabled bool   `gorm:"not null;default:false"`
+	// TOTPLastCounter is the last time step accepted, so a code cannot be replayed.
+	TOTPLastCounter int64 `gorm:"not null;default:0"`
 }
 
 type SessionMetadata struct {
-	UserID    uuid.UUID `json:"user_id"`
-	Email     string    `json:"email"`
-	Tier      string    `json:"tier"`
-	LastLogin time.Time `json:"last_login"`
-	IPAddress string    `json:"ip_address"`
+	SessionID   string    `json:"session_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	Tier        tier.Tier `json:"tier"`
+	Role        Role      `json:"role"`
+	LastLogin   time.Time `json:"last_login"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	DeviceLabel string    `json:"device_label"`
+}
+
+// ClientInfo describes the device a session was started from.
+type ClientInfo struct {
+	IPAddress   string
+	UserAgent   string
+	DeviceLabel string
+}
+
+// TokenPair is what a login or refresh hands back. Token is the short-lived
+// access token sent as "Authorization: Bearer"; RefreshToken is exchanged at
+// /api/token/refresh for a new pair and works only once.
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/nazrawigedion123/wallet-backend/auth/handlers"
 	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
 	"github.com/nazrawigedion123/wallet-backend/auth/services"
 )
 
@@ -11,11 +12,67 @@ func RegisterAuthRoutes(e *echo.Group, authHandler *handlers.AuthHandler, sessio
 	// Public
 	e.POST("/register", authHandler.Register)
 	e.POST("/login", authHandler.Login)
+	e.POST("/login/2fa", authHandler.LoginTwoFactor)
+	e.POST("/token/refresh", authHandler.Refresh)
+	e.POST("/email/verify", authHandler.VerifyEmail)
+	e.POST("/email/verify/resend", authHandler.ResendVerification)
+	e.POST("/password/forgot", authHandler.ForgotPassword)
+	e.POST("/password/reset", authHandler.ResetPassword)
 
 	// Protected
 	authGroup := e.Group("")
 	authGroup.Use(middleware.AuthMiddleware(sessionSvc))
 	authGroup.GET("/profile", authHandler.Profile)
 	authGroup.POST("/tiers/upgrade", authHandler.TierUpgrade)
+	authGroup.GET("/tiers/history", authHandler.TierHistory)
 	authGroup.POST("/logout", authHandler.Logout)
+	authGroup.GET("/sessions", authHandler.ListSessions)
+	authGroup.DELETE("/sessions", authHandler.RevokeAllSessions)
+	authGroup.DELETE("/sessions/:id", authHandler.RevokeSession)
+	authGroup.POST("/2fa/enroll", authHandler.BeginTwoFactor)
+	authGroup.POST("/2fa/confirm", authHandler.ConfirmTwoFactor)
+	authGroup.POST("/2fa/disable", authHandler.DisableTwoFactor)
+	authGroup.POST("/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+}
+
+// RegisterAdminRoutes exposes user management to staff roles.
+func RegisterAdminRoutes(e *echo.Group, adminHandler *handlers.AdminHandler, sessionSvc *services.SessionService) {
+	adminGroup := e.Group("/admin/users")
+	adminGroup.Use(middleware.AuthMiddleware(sessionSvc))
+
+	adminGroup.GET("", adminHandler.ListUsers, middleware.RequirePermission(models.PermViewUsers))
+	adminGroup.GET("/:id", adminHandler.GetUser, middleware.RequirePermission(models.PermViewUsers))
+	adminGroup.PUT("/:id/role", adminHandler.SetRole, middleware.RequirePermission(models.PermManageUsers))
+	adminGroup.POST("/:id/unlock", adminHandler.UnlockUser, middleware.RequirePermission(models.PermManageUsers))
+	adminGroup.GET("/:id/tiers", adminHandler.GetTierHistory, middleware.RequirePermission(models.PermViewUsers))
+	adminGroup.PUT("/:id/tier", adminHandler.SetTier, middleware.RequirePermission(models.PermManageUsers))
+}
+
+// RegisterOIDCRoutes serves single sign-on. It is only registered when an
+// identity provider is configured.
+func RegisterOIDCRoutes(e *echo.Group, oidcHandler *handlers.OIDCHandler) {
+	e.GET("/oidc/login", oidcHandler.Login)
+	e.GET("/oidc/callback", oidcHandler.Callback)
+}
+
+// RegisterJWKSRoutes publishes the token verification keys at the root,
+// where other services expect to find them.
+func RegisterJWKSRoutes(e *echo.Echo, keysHandler *handlers.KeysHandler) {
+	e.GET("/.well-known/jwks.json", keysHandler.JWKS)
+}
+
+// RegisterAPIKeyRoutes lets users manage their own API keys and staff manage
+// keys for any user. Keys are only managed from a session, never with a key.
+func RegisterAPIKeyRoutes(e *echo.Group, apiKeyHandler *handlers.APIKeyHandler, sessionSvc *services.SessionService) {
+	keyGroup := e.Group("/keys")
+	keyGroup.Use(middleware.AuthMiddleware(sessionSvc))
+	keyGroup.POST("", apiKeyHandler.CreateAPIKey)
+	keyGroup.GET("", apiKeyHandler.ListAPIKeys)
+	keyGroup.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+
+	adminGroup := e.Group("/admin/users/:id/keys")
+	adminGroup.Use(middleware.AuthMiddleware(sessionSvc))
+	adminGroup.GET("", apiKeyHandler.ListUserAPIKeys, middleware.RequirePermission(models.PermViewUsers))
+	adminGroup.POST("", apiKeyHandler.CreateUserAPIKey, middleware.RequirePermission(models.PermManageUsers))
+	adminGroup.DELETE("/:key_id", apiKeyHandler.RevokeUserAPIKey, middleware.RequirePermission(models.PermManageUsers))
 }
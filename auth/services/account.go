@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/mailer"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAccountToken = errors.New("invalid or expired token")
+	ErrEmailNotVerified    = errors.New("email address has not been verified")
+)
+
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// AccountService runs the flows that prove ownership of an email address:
+// verifying it after sign-up and resetting a forgotten password.
+type AccountService struct {
+	db         *gorm.DB
+	sessionSvc *SessionService
+	mailer     mailer.Mailer
+	from       string
+	// appURL is where the links in mails point, e.g. https://wallet.example.com.
+	appURL string
+}
+
+func NewAccountService(db *gorm.DB, sessionSvc *SessionService, m mailer.Mailer, from, appURL string) *AccountService {
+	return &AccountService{
+		db:         db,
+		sessionSvc: sessionSvc,
+		mailer:     m,
+		from:       from,
+		appURL:     strings.TrimRight(appURL, "/"),
+	}
+}
+
+// SendVerification mails the user a link to verify their address. Earlier
+// verification links stop working.
+func (s *AccountService) SendVerification(user *user_models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	token, err := s.issueToken(user.ID, user_models.TokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(context.Background(), mailer.Message{
+		From:    s.from,
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below within %s.\n\n%s\n",
+			verifyEmailTTL, s.link("/verify-email", token)),
+	})
+}
+
+// ResendVerification sends a new verification link to email if it belongs
+// to an unverified user. It does not say whether the address is registered.
+func (s *AccountService) ResendVerification(email string) error {
+	var user user_models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.SendVerification(&user)
+}
+
+// VerifyEmail marks the token's user as verified.
+func (s *AccountService) VerifyEmail(token string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := s.consumeToken(tx, user_models.TokenVerifyEmail, token)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&user_models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userID).
+			Update("email_verified_at", time.Now()).Error
+	})
+}
+
+// ForgotPassword mails a reset link if email is registered. It does not say
+// whether the address is registered.
+func (s *AccountService) ForgotPassword(email string) error {
+	var user user_models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueToken(user.ID, user_models.TokenResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(context.Background(), mailer.Message{
+		From:    s.from,
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset your password. Open the link below within %s to choose a new one.\n\n%s\n\nIf it wasn't you, ignore this email.\n",
+			resetPasswordTTL, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password and logs the user out everywhere.
+// Following a reset link also proves the user owns the address.
+func (s *AccountService) ResetPassword(token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	var userID uuid.UUID
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		userID, err = s.consumeToken(tx, user_models.TokenResetPassword, token)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&user_models.User{}).Where("id = ?", userID).
+			Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user_models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.sessionSvc.RevokeAllSessions(userID, "")
+	return err
+}
+
+// issueToken replaces any unused token of the same purpose with a new one
+// and returns the raw token, which is never stored.
+func (s *AccountService) issueToken(userID uuid.UUID, purpose user_models.TokenPurpose, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&user_models.AccountToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user_models.AccountToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashAccountToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeToken marks a live token used and returns its user. The conditional
+// update makes sure only one caller can use a token.
+func (s *AccountService) consumeToken(tx *gorm.DB, purpose user_models.TokenPurpose, token string) (uuid.UUID, error) {
+	var record user_models.AccountToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashAccountToken(token), purpose).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&user_models.AccountToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", record.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, ErrInvalidAccountToken
+	}
+	return record.UserID, nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidScope   = errors.New("invalid scope")
+)
+
+const (
+	// apiKeyPrefix marks our keys so they are easy to spot in leaked logs.
+	apiKeyPrefix = "wk_"
+	// apiKeyTouchInterval is how stale last_used_at may get before a request
+	// updates it, so busy keys do not write on every call.
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService issues and checks the API keys servers use instead of a
+// session.
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// Create issues a key for userID on behalf of actorID and returns it along
+// with the key itself, which cannot be recovered later.
+func (s *APIKeyService) Create(userID, actorID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*user_models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+	granted, err := parseScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var count int64
+	if err := s.db.Model(&user_models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count == 0 {
+		return nil, "", ErrUserNotFound
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	record := user_models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		KeyHash:   hashAPIKey(key),
+		Scopes:    granted,
+		CreatedBy: actorID,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, "", err
+	}
+	return &record, key, nil
+}
+
+// List returns the user's keys, newest first, including revoked ones.
+func (s *APIKeyService) List(userID uuid.UUID) ([]user_models.APIKey, error) {
+	var keys []user_models.APIKey
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke stops one of the user's keys from working.
+func (s *APIKeyService) Revoke(userID, keyID uuid.UUID) error {
+	result := s.db.Model(&user_models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the key and its owner if key is live.
+func (s *APIKeyService) Authenticate(key string) (*user_models.APIKey, *user_models.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var record user_models.APIKey
+	err := s.db.Where("key_hash = ?", hashAPIKey(key)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user user_models.User
+	err = s.db.First(&user, "id = ?", record.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > apiKeyTouchInterval {
+		s.db.Model(&record).Update("last_used_at", now)
+	}
+	return &record, &user, nil
+}
+
+func parseScopes(names []string) ([]user_models.Scope, error) {
+	var scopes []user_models.Scope
+	seen := map[user_models.Scope]bool{}
+	for _, name := range names {
+		scope, ok := user_models.ParseScope(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, name)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return scopes, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"sync"
 
 	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
 
@@ -17,34 +18,93 @@ var (
 type AuthService struct {
 	db         *gorm.DB
 	sessionSvc *SessionService
+	twoFactor  *TwoFactorService
+	guard      *LoginGuard
 }
 
-func NewAuthService(db *gorm.DB, sessionSvc *SessionService) *AuthService {
+func NewAuthService(db *gorm.DB, sessionSvc *SessionService, twoFactor *TwoFactorService, guard *LoginGuard) *AuthService {
 	return &AuthService{
 		db:         db,
 		sessionSvc: sessionSvc,
+		twoFactor:  twoFactor,
+		guard:      guard,
 	}
 }
 
-func (s *AuthService) Login(email, password, ipAddress string) (string, *user_models.User, error) {
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends as long as a real password check so unknown
+// emails cannot be told apart by response time.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// Login checks the password. Users with two-factor enabled get a challenge
+// to finish with CompleteLogin instead of tokens. Repeated failures from an
+// account or IP are slowed down and then locked out by the login guard.
+func (s *AuthService) Login(email, password string, client user_models.ClientInfo) (*user_models.LoginResult, error) {
+	if err := s.guard.Check(email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	var user user_models.User
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
-
-		return "", nil, ErrUserNotFound
+		compareDummyPassword(password)
+		s.guard.RecordFailure(email, client.IPAddress, "")
+		return nil, ErrUserNotFound
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		s.guard.RecordFailure(email, client.IPAddress, user.Email)
+		return nil, ErrInvalidPassword
+
+	}
+	s.guard.RecordSuccess(email)
+
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
 
-		return "", nil, ErrInvalidPassword
+	if user.TOTPEnabled {
+		challenge, err := s.twoFactor.StartChallenge(user.ID, client)
+		if err != nil {
+			return nil, err
+		}
+		return &user_models.LoginResult{User: &user, Challenge: challenge}, nil
+	}
 
+	tokens, err := s.sessionSvc.CreateSession(&user, client)
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := s.sessionSvc.CreateSession(&user, ipAddress)
+	return &user_models.LoginResult{Tokens: tokens, User: &user}, nil
+}
+
+// CompleteLogin finishes a two-factor login with a TOTP or recovery code.
+func (s *AuthService) CompleteLogin(challengeID, code string) (*user_models.LoginResult, error) {
+	userID, client, err := s.twoFactor.CompleteChallenge(challengeID, code)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+
+	var user user_models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	tokens, err := s.sessionSvc.CreateSession(&user, client)
+	if err != nil {
+		return nil, err
 	}
 
-	return token, &user, nil
+	return &user_models.LoginResult{Tokens: tokens, User: &user}, nil
 }
 
 func (s *AuthService) Register(email, password string) (*user_models.User, error) {
@@ -56,7 +116,6 @@ func (s *AuthService) Register(email, password string) (*user_models.User, error
 	user := user_models.User{
 		Email:    email,
 		Password: string(hashedPassword),
-		
 	}
 
 	if err := s.db.Create(&user).Error; err != nil {
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/mailer"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLoginThrottled = errors.New("too many failed logins, slow down")
+	ErrAccountLocked  = errors.New("account temporarily locked after too many failed logins")
+)
+
+// LockoutChannel carries a JSON LockoutEvent for every lockout.
+const LockoutChannel = "auth:lockouts"
+
+// LoginBlockedError says a login was refused before the password was
+// checked, and when it is worth trying again.
+type LoginBlockedError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Err
+}
+
+// LoginGuardConfig sets how fast failed logins are slowed down and locked out.
+// Failures are counted per account and per client IP over Window.
+type LoginGuardConfig struct {
+	Window time.Duration
+	// FreeAttempts failures are allowed before any delay; each failure after
+	// that doubles the delay, starting at BaseDelay and capped at MaxDelay.
+	FreeAttempts int64
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// AccountLockAfter failures lock the account, and IPLockAfter failures
+	// block the address, for LockDuration.
+	AccountLockAfter int64
+	IPLockAfter      int64
+	LockDuration     time.Duration
+}
+
+var DefaultLoginGuardConfig = LoginGuardConfig{
+	Window:           15 * time.Minute,
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	AccountLockAfter: 10,
+	IPLockAfter:      50,
+	LockDuration:     30 * time.Minute,
+}
+
+// LoginGuard throttles password guessing. Counters live in Redis so every
+// instance of the API shares them.
+type LoginGuard struct {
+	redisClient *redis.Client
+	config      LoginGuardConfig
+	mailer      mailer.Mailer
+	from        string
+}
+
+func NewLoginGuard(redisClient *redis.Client, config LoginGuardConfig, m mailer.Mailer, from string) *LoginGuard {
+	return &LoginGuard{
+		redisClient: redisClient,
+		config:      config,
+		mailer:      m,
+		from:        from,
+	}
+}
+
+// Check refuses the attempt while the account or IP is locked or backing
+// off. It does not count as a failure itself.
+func (g *LoginGuard) Check(email, ip string) error {
+	ctx := context.Background()
+	checks := []struct {
+		key string
+		err error
+	}{
+		{g.lockKey("acct", email), ErrAccountLocked},
+		{g.lockKey("ip", ip), ErrAccountLocked},
+		{g.delayKey("acct", email), ErrLoginThrottled},
+		{g.delayKey("ip", ip), ErrLoginThrottled},
+	}
+
+	pipe := g.redisClient.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(checks))
+	for i, check := range checks {
+		ttls[i] = pipe.PTTL(ctx, check.key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return ErrRedisUnavailable
+	}
+
+	for i, check := range checks {
+		if ttl := ttls[i].Val(); ttl > 0 {
+			return &LoginBlockedError{Err: check.err, RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login against the account and the IP and
+// starts any backoff or lockout it earns. notify is the registered address to
+// warn if the account gets locked; it is empty for unknown accounts so
+// failed logins cannot be used to mail arbitrary addresses.
+func (g *LoginGuard) RecordFailure(email, ip, notify string) {
+	ctx := context.Background()
+	acctKey, ipKey := g.failuresKey("acct", email), g.failuresKey("ip", ip)
+
+	pipe := g.redisClient.TxPipeline()
+	acctFailures := pipe.Incr(ctx, acctKey)
+	pipe.ExpireNX(ctx, acctKey, g.config.Window)
+	ipFailures := pipe.Incr(ctx, ipKey)
+	pipe.ExpireNX(ctx, ipKey, g.config.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("failed to record login failure: %v", err)
+		return
+	}
+
+	g.penalize("acct", email, acctFailures.Val(), g.config.AccountLockAfter, notify)
+	g.penalize("ip", ip, ipFailures.Val(), g.config.IPLockAfter, "")
+}
+
+// RecordSuccess clears the account's failures. The IP keeps its count so one
+// good login cannot launder guesses against other accounts.
+func (g *LoginGuard) RecordSuccess(email string) {
+	g.redisClient.Del(context.Background(), g.failuresKey("acct", email), g.delayKey("acct", email))
+}
+
+// Unlock lifts a lockout and forgets the account's failures.
+func (g *LoginGuard) Unlock(email string) error {
+	err := g.redisClient.Del(context.Background(),
+		g.failuresKey("acct", email), g.delayKey("acct", email), g.lockKey("acct", email)).Err()
+	if err != nil {
+		return ErrRedisUnavailable
+	}
+	return nil
+}
+
+func (g *LoginGuard) penalize(scope, subject string, failures, lockAfter int64, notify string) {
+	ctx := context.Background()
+	if failures >= lockAfter {
+		// SETNX so only the failure that crosses the line announces it.
+		locked, err := g.redisClient.SetNX(ctx, g.lockKey(scope, subject), failures, g.config.LockDuration).Result()
+		if err == nil && locked {
+			g.announceLockout(scope, subject, failures, notify)
+		}
+		return
+	}
+
+	if delay := g.backoff(failures); delay > 0 {
+		g.redisClient.Set(ctx, g.delayKey(scope, subject), failures, delay)
+	}
+}
+
+// backoff is the delay after the given number of failures.
+func (g *LoginGuard) backoff(failures int64) time.Duration {
+	over := failures - g.config.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := g.config.BaseDelay
+	for i := int64(1); i < over && delay < g.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.config.MaxDelay {
+		delay = g.config.MaxDelay
+	}
+	return delay
+}
+
+func (g *LoginGuard) announceLockout(scope, subject string, failures int64, notify string) {
+	ctx := context.Background()
+	event := user_models.LockoutEvent{
+		Failures: failures,
+		Until:    time.Now().Add(g.config.LockDuration),
+	}
+	if scope == "acct" {
+		event.Email = subject
+	} else {
+		event.IPAddress = subject
+	}
+	log.Printf("🔒 Login lockout: %s %s after %d failures", scope, subject, failures)
+
+	payload, _ := json.Marshal(event)
+	if err := g.redisClient.Publish(ctx, LockoutChannel, payload).Err(); err != nil {
+		log.Printf("failed to publish lockout event: %v", err)
+	}
+
+	if notify == "" || g.mailer == nil {
+		return
+	}
+	err := g.mailer.Send(ctx, mailer.Message{
+		From:    g.from,
+		To:      notify,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("We saw %d failed logins to your account, so logins are paused until %s.\n\nIf this wasn't you, reset your password once the lock ends.\n",
+			failures, event.Until.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("failed to send lockout email: %v", err)
+	}
+}
+
+func (g *LoginGuard) failuresKey(scope, subject string) string {
+	return "login:failures:" + scope + ":" + normalizeSubject(subject)
+}
+
+func (g *LoginGuard) delayKey(scope, subject string) string {
+	return "login:delay:" + scope + ":" + normalizeSubject(subject)
+}
+
+func (g *LoginGuard) lockKey(scope, subject string) string {
+	return "login:lock:" + scope + ":" + normalizeSubject(subject)
+}
+
+func normalizeSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(subject))
+}
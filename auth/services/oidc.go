@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/oidc"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidOIDCState     = errors.New("sign-in request not found or expired")
+	ErrOIDCEmailNotVerified = errors.New("identity provider has not verified the email address")
+	ErrOIDCAccountNotFound  = errors.New("no account matches this identity")
+	// ErrOIDCAccountUnverified stops an identity from taking over an
+	// account whose owner never proved the email address: whoever
+	// registered it may not own the address, and would keep their
+	// password and sessions.
+	ErrOIDCAccountUnverified = errors.New("verify the email address of your existing account before signing in with this provider")
+)
+
+// oidcStateTTL is how long the user has to sign in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcState is what we remember between sending the user to the provider
+// and them coming back.
+type oidcState struct {
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	DeviceLabel string `json:"device_label"`
+}
+
+// OIDCService logs users in through an OpenID provider. An identity is
+// matched to an account by its issuer and subject, or on first sign-in by
+// the provider's verified email if the account has verified it too; unknown
+// emails get a new account only if autoProvision is set.
+type OIDCService struct {
+	db            *gorm.DB
+	redisClient   *redis.Client
+	provider      *oidc.Provider
+	sessionSvc    *SessionService
+	twoFactor     *TwoFactorService
+	autoProvision bool
+}
+
+func NewOIDCService(db *gorm.DB, redisClient *redis.Client, provider *oidc.Provider, sessionSvc *SessionService, twoFactor *TwoFactorService, autoProvision bool) *OIDCService {
+	return &OIDCService{
+		db:            db,
+		redisClient:   redisClient,
+		provider:      provider,
+		sessionSvc:    sessionSvc,
+		twoFactor:     twoFactor,
+		autoProvision: autoProvision,
+	}
+}
+
+// Begin starts a sign-in and returns the provider URL to send the user to.
+func (s *OIDCService) Begin(deviceLabel string) (string, error) {
+	stateID := oidc.RandomString()
+	state := oidcState{
+		Nonce:       oidc.RandomString(),
+		Verifier:    oidc.NewVerifier(),
+		DeviceLabel: deviceLabel,
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisClient.Set(context.Background(), s.stateKey(stateID), data, oidcStateTTL).Err(); err != nil {
+		return "", ErrRedisUnavailable
+	}
+
+	return s.provider.AuthCodeURL(stateID, state.Nonce, state.Verifier), nil
+}
+
+// Complete finishes a sign-in with the code the provider redirected back
+// with. Like a password login, users with two-factor enabled get a
+// challenge instead of tokens.
+func (s *OIDCService) Complete(ctx context.Context, stateID, code string, client user_models.ClientInfo) (*user_models.LoginResult, error) {
+	data, err := s.redisClient.GetDel(ctx, s.stateKey(stateID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, ErrRedisUnavailable
+	}
+	var state oidcState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	client.DeviceLabel = state.DeviceLabel
+
+	tokens, err := s.provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.Verify(ctx, tokens.IDToken, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.linkUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.twoFactor.StartChallenge(user.ID, client)
+		if err != nil {
+			return nil, err
+		}
+		return &user_models.LoginResult{User: user, Challenge: challenge}, nil
+	}
+
+	pair, err := s.sessionSvc.CreateSession(user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &user_models.LoginResult{Tokens: pair, User: user}, nil
+}
+
+// linkUser finds the account for the identity, linking or creating one the
+// first time the identity signs in.
+func (s *OIDCService) linkUser(claims *oidc.Claims) (*user_models.User, error) {
+	var user user_models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		issuer := s.provider.Issuer()
+
+		var identity user_models.OIDCIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Model(&identity).Updates(map[string]interface{}{"email": claims.Email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, "id = ?", identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only an address the provider vouches for may claim an account.
+		email := strings.ToLower(strings.TrimSpace(claims.Email))
+		if email == "" || !bool(claims.EmailVerified) {
+			return ErrOIDCEmailNotVerified
+		}
+
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !s.autoProvision {
+				return ErrOIDCAccountNotFound
+			}
+			// The account is only reachable through the provider until
+			// the user sets a password with a reset.
+			password, err := bcrypt.GenerateFromPassword([]byte(oidc.RandomString()), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			user = user_models.User{Email: email, Password: string(password), Tier: tier.Basic, EmailVerifiedAt: &now}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case user.EmailVerifiedAt == nil:
+			return ErrOIDCAccountUnverified
+		}
+
+		return tx.Create(&user_models.OIDCIdentity{
+			UserID:      user.ID,
+			Issuer:      issuer,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *OIDCService) stateKey(stateID string) string {
+	return "oidc:state:" + stateID
+}
@@ -3,139 +3,439 @@ package services
 import (
 	"context"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/keyring"
 	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	ErrRedisUnavailable = errors.New("redis service unavailable")
-	ErrInvalidToken     = errors.New("invalid token")
+	ErrRedisUnavailable   = errors.New("redis service unavailable")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	ErrSessionNotFound    = errors.New("session not found")
 )
 
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+// rotateRefreshScript swaps the session's current refresh token id for a new
+// one only if the presented id is still current. It returns 1 on success,
+// 0 if the presented id is stale (the token was already used) and -1 if the
+// session no longer exists.
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'RefreshID')
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'RefreshID', ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// updateSessionScript sets one field of a session hash if the session still
+// exists, so an update never resurrects an expired session.
+var updateSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// SessionService issues short-lived access tokens and long-lived refresh
+// tokens. Every login starts a session (a token family) stored in Redis under
+// session:<id>; each refresh rotates the family's refresh token, and
+// presenting an already-rotated refresh token revokes the whole family.
+// user:sessions:<user id> indexes a user's session ids so they can be listed
+// and revoked together; ids whose session has expired are pruned on read.
+//
+// Tokens are signed with the key ring's active key and name it in their kid
+// header. legacySecret, if set, still verifies HS256 tokens issued before
+// the key ring, until they expire.
 type SessionService struct {
-	redisClient *redis.Client
-	secretKey   []byte
-	sessionTTL  time.Duration
+	redisClient  *redis.Client
+	keys         *keyring.KeyRing
+	legacySecret []byte
+	accessTTL    time.Duration
+	refreshTTL   time.Duration
 }
 
-func NewSessionService(redisClient *redis.Client, secretKey string, ttl time.Duration) *SessionService {
-	return &SessionService{
+func NewSessionService(redisClient *redis.Client, keys *keyring.KeyRing, legacySecret string, accessTTL, refreshTTL time.Duration) *SessionService {
+	s := &SessionService{
 		redisClient: redisClient,
-		secretKey:   []byte(secretKey),
-		sessionTTL:  ttl,
+		keys:        keys,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}
+	if legacySecret != "" {
+		s.legacySecret = []byte(legacySecret)
 	}
+	return s
 }
 
-func (s *SessionService) CreateSession(user *user_models.User, ipAddress string) (string, error) {
-	// Create JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(s.sessionTTL).Unix(),
-		"iat": time.Now().Unix(),
-	})
+func (s *SessionService) CreateSession(user *user_models.User, client user_models.ClientInfo) (*user_models.TokenPair, error) {
+	sessionID := uuid.NewString()
+	refreshID := uuid.NewString()
+
+	// Convert struct to a map for Redis HSET
+	metadata := map[string]interface{}{
+		"UserID":      user.ID.String(),
+		"Email":       user.Email,
+		"Tier":        string(user.Tier),
+		"Role":        string(user.Role),
+		"LastLogin":   time.Now().Format(time.RFC3339), // store as string
+		"IPAddress":   client.IPAddress,
+		"UserAgent":   client.UserAgent,
+		"DeviceLabel": client.DeviceLabel,
+		"RefreshID":   refreshID,
+	}
 
-	tokenString, err := token.SignedString(s.secretKey)
+	ctx := context.Background()
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.sessionKey(sessionID), metadata)
+		pipe.Expire(ctx, s.sessionKey(sessionID), s.refreshTTL)
+		pipe.SAdd(ctx, s.userSessionsKey(user.ID), sessionID)
+		pipe.Expire(ctx, s.userSessionsKey(user.ID), s.refreshTTL)
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Convert struct to a map for Redis HSET
-	metadata := map[string]interface{}{
-		"UserID":    user.ID.String(),
-		"Email":     user.Email,
-		"Tier":      user.Tier,
-		"LastLogin": time.Now().Format(time.RFC3339), // store as string
-		"IPAddress": ipAddress,
+	return s.issueTokens(user.ID, sessionID, refreshID)
+}
+
+func (s *SessionService) ValidateSession(tokenString string) (*user_models.SessionMetadata, error) {
+	claims, err := s.parseToken(tokenString, accessTokenType)
+	if err != nil {
+		return nil, err
 	}
 
+	// Check Redis for session data
 	ctx := context.Background()
-	err = s.redisClient.HSet(ctx, "session:"+tokenString, metadata).Err()
+	result, err := s.redisClient.HGetAll(ctx, s.sessionKey(claims.sessionID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrInvalidToken
+		}
+		return nil, ErrRedisUnavailable
+	}
+
+	if len(result) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	metadata := s.metadataFromHash(claims.sessionID, result)
+	if claims.userID != metadata.UserID {
+		return nil, ErrInvalidToken
+	}
+
+	return metadata, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// Each refresh token works once; if a spent one comes back, someone else
+// holds a copy, so the whole session is revoked.
+func (s *SessionService) Refresh(refreshToken string) (*user_models.TokenPair, error) {
+	claims, err := s.parseToken(refreshToken, refreshTokenType)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if claims.tokenID == "" {
+		return nil, ErrInvalidToken
 	}
 
-	// Set TTL for the session
-	err = s.redisClient.Expire(ctx, "session:"+tokenString, s.sessionTTL).Err()
+	ctx := context.Background()
+	nextRefreshID := uuid.NewString()
+	result, err := rotateRefreshScript.Run(ctx, s.redisClient,
+		[]string{s.sessionKey(claims.sessionID)},
+		claims.tokenID, nextRefreshID, int(s.refreshTTL.Seconds()),
+	).Int()
 	if err != nil {
-		return "", err
+		return nil, ErrRedisUnavailable
 	}
 
-	return tokenString, nil
+	switch result {
+	case 1:
+		s.redisClient.Expire(ctx, s.userSessionsKey(claims.userID), s.refreshTTL)
+		return s.issueTokens(claims.userID, claims.sessionID, nextRefreshID)
+	case 0:
+		if err := s.InvalidateSession(claims.sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	default:
+		return nil, ErrInvalidToken
+	}
 }
 
-func (s *SessionService) ValidateSession(tokenString string) (*user_models.SessionMetadata, error) {
-	// Parse JWT token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
+// InvalidateSession revokes a session and every token issued for it.
+func (s *SessionService) InvalidateSession(sessionID string) error {
+	ctx := context.Background()
+	userID, err := s.redisClient.HGet(ctx, s.sessionKey(sessionID), "UserID").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.sessionKey(sessionID))
+		if owner, err := uuid.Parse(userID); err == nil {
+			pipe.SRem(ctx, s.userSessionsKey(owner), sessionID)
 		}
-		return s.secretKey, nil
+		return nil
 	})
+	return err
+}
 
-	if err != nil || !token.Valid {
-		return nil, ErrInvalidToken
+// ListSessions returns the user's live sessions, most recent login first.
+func (s *SessionService) ListSessions(userID uuid.UUID) ([]user_models.SessionMetadata, error) {
+	ctx := context.Background()
+	sessionIDs, err := s.redisClient.SMembers(ctx, s.userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, ErrRedisUnavailable
 	}
 
-	// Check Redis for session data
+	hashes := make([]*redis.MapStringStringCmd, len(sessionIDs))
+	_, err = s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, sessionID := range sessionIDs {
+			hashes[i] = pipe.HGetAll(ctx, s.sessionKey(sessionID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	sessions := make([]user_models.SessionMetadata, 0, len(sessionIDs))
+	var expired []interface{}
+	for i, sessionID := range sessionIDs {
+		result := hashes[i].Val()
+		if len(result) == 0 {
+			expired = append(expired, sessionID)
+			continue
+		}
+		sessions = append(sessions, *s.metadataFromHash(sessionID, result))
+	}
+	if len(expired) > 0 {
+		s.redisClient.SRem(ctx, s.userSessionsKey(userID), expired...)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastLogin.After(sessions[j].LastLogin) })
+	return sessions, nil
+}
+
+// RevokeSession logs out one of the user's sessions. Sessions belonging to
+// other users are reported as not found.
+func (s *SessionService) RevokeSession(userID uuid.UUID, sessionID string) error {
 	ctx := context.Background()
-	//metadata := &user_models.SessionMetadata{}
+	owner, err := s.redisClient.HGet(ctx, s.sessionKey(sessionID), "UserID").Result()
+	if err == redis.Nil || (err == nil && owner != userID.String()) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return ErrRedisUnavailable
+	}
+	return s.InvalidateSession(sessionID)
+}
 
-	result, err := s.redisClient.HGetAll(ctx, "session:"+tokenString).Result()
+// RevokeAllSessions logs the user out everywhere except keepSessionID, which
+// may be empty. It returns how many sessions were revoked.
+func (s *SessionService) RevokeAllSessions(userID uuid.UUID, keepSessionID string) (int, error) {
+	ctx := context.Background()
+	sessionIDs, err := s.redisClient.SMembers(ctx, s.userSessionsKey(userID)).Result()
 	if err != nil {
+		return 0, ErrRedisUnavailable
+	}
 
-		if err == redis.Nil {
-			return nil, ErrInvalidToken
+	var revoked []string
+	for _, sessionID := range sessionIDs {
+		if sessionID != keepSessionID {
+			revoked = append(revoked, sessionID)
 		}
-		return nil, ErrRedisUnavailable
+	}
+	if len(revoked) == 0 {
+		return 0, nil
 	}
 
-	if len(result) == 0 {
-		return nil, ErrInvalidToken
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sessionID := range revoked {
+			pipe.Del(ctx, s.sessionKey(sessionID))
+			pipe.SRem(ctx, s.userSessionsKey(userID), sessionID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return len(revoked), nil
+}
 
-	metadata := &user_models.SessionMetadata{}
-	if uid, ok := result["UserID"]; ok {
+// UpdateTier rewrites the tier on every live session of the user so the
+// change takes effect on their next request instead of their next login.
+func (s *SessionService) UpdateTier(userID uuid.UUID, t tier.Tier) error {
+	ctx := context.Background()
+	sessionIDs, err := s.redisClient.SMembers(ctx, s.userSessionsKey(userID)).Result()
+	if err != nil {
+		return ErrRedisUnavailable
+	}
 
-		parsedUUID, err := uuid.Parse(uid)
+	for _, sessionID := range sessionIDs {
+		if err := updateSessionScript.Run(ctx, s.redisClient, []string{s.sessionKey(sessionID)}, "Tier", string(t)).Err(); err != nil {
+			return ErrRedisUnavailable
+		}
+	}
+	return nil
+}
 
-		if err == nil {
+func (s *SessionService) sessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
 
+func (s *SessionService) userSessionsKey(userID uuid.UUID) string {
+	return "user:sessions:" + userID.String()
+}
+
+func (s *SessionService) metadataFromHash(sessionID string, result map[string]string) *user_models.SessionMetadata {
+	metadata := &user_models.SessionMetadata{SessionID: sessionID}
+	if uid, ok := result["UserID"]; ok {
+		parsedUUID, err := uuid.Parse(uid)
+		if err == nil {
 			metadata.UserID = parsedUUID
 		}
 	}
 	metadata.Email = result["Email"]
-	metadata.Tier = result["Tier"]
+	metadata.Tier = tier.Normalize(result["Tier"])
+	// Sessions issued before roles existed carry no role and get the default.
+	metadata.Role = user_models.RoleUser
+	if role, ok := user_models.ParseRole(result["Role"]); ok {
+		metadata.Role = role
+	}
 	metadata.IPAddress = result["IPAddress"]
+	metadata.UserAgent = result["UserAgent"]
+	metadata.DeviceLabel = result["DeviceLabel"]
 	if lastLoginStr, ok := result["LastLogin"]; ok {
 		t, _ := time.Parse(time.RFC3339, lastLoginStr)
 		metadata.LastLogin = t
 	}
+	return metadata
+}
+
+func (s *SessionService) issueTokens(userID uuid.UUID, sessionID, refreshID string) (*user_models.TokenPair, error) {
+	now := time.Now()
+
+	accessToken, err := s.sign(jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"typ": accessTokenType,
+		"exp": now.Add(s.accessTTL).Unix(),
+		"iat": now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.sign(jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"jti": refreshID,
+		"typ": refreshTokenType,
+		"exp": now.Add(s.refreshTTL).Unix(),
+		"iat": now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user_models.TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.accessTTL.Seconds()),
+		RefreshExpiresIn: int64(s.refreshTTL.Seconds()),
+	}, nil
+}
+
+func (s *SessionService) sign(claims jwt.MapClaims) (string, error) {
+	key := s.keys.Active()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Signer())
+}
+
+// verificationKey picks the key named by the token's kid and makes sure the
+// token was signed with that key's algorithm, so a public key can never be
+// passed off as an HMAC secret.
+func (s *SessionService) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || s.legacySecret == nil {
+			return nil, ErrInvalidToken
+		}
+		return s.legacySecret, nil
+	}
+
+	key, err := s.keys.Lookup(context.Background(), kid)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if token.Method.Alg() != string(key.Algorithm) {
+		return nil, ErrInvalidToken
+	}
+	return key.Public(), nil
+}
+
+type tokenClaims struct {
+	userID    uuid.UUID
+	sessionID string
+	tokenID   string
+}
+
+// parseToken checks the signature, expiry and type of a token and pulls out
+// the claims every token carries.
+func (s *SessionService) parseToken(tokenString, tokenType string) (*tokenClaims, error) {
+	token, err := jwt.Parse(tokenString, s.verificationKey)
+
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
 		return nil, ErrInvalidToken
 	}
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidToken
+	}
 
 	subStr, ok := claims["sub"].(string)
 	if !ok {
 		return nil, ErrInvalidToken
 	}
-
 	subUUID, err := uuid.Parse(subStr)
-	if err != nil || subUUID != metadata.UserID {
+	if err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	return metadata, nil
-}
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	tokenID, _ := claims["jti"].(string)
 
-func (s *SessionService) InvalidateSession(tokenString string) error {
-	ctx := context.Background()
-	_, err := s.redisClient.Del(ctx, "session:"+tokenString).Result()
-	return err
+	return &tokenClaims{userID: subUUID, sessionID: sessionID, tokenID: tokenID}, nil
 }
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/auth/interfaces"
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTierUnchanged = errors.New("user is already on that tier")
+	ErrTierConflict  = errors.New("tier changed concurrently, try again")
+)
+
+// TierService moves users between tiers, keeps a history of every move and
+// pushes the new tier into the user's live sessions.
+type TierService struct {
+	db         *gorm.DB
+	sessionSvc *SessionService
+	// billing charges for self-service upgrades; without it users cannot
+	// upgrade themselves.
+	billing interfaces.TierBilling
+}
+
+func NewTierService(db *gorm.DB, sessionSvc *SessionService, billing interfaces.TierBilling) *TierService {
+	return &TierService{
+		db:         db,
+		sessionSvc: sessionSvc,
+		billing:    billing,
+	}
+}
+
+// ChangeTier moves the user to the named tier on behalf of actorID. With
+// charge set, upgrades are paid for from the user's wallet, and refused for
+// tiers that have no price; downgrades are never charged or refunded.
+func (s *TierService) ChangeTier(userID, actorID uuid.UUID, to string, reason string, charge bool) (*user_models.User, error) {
+	target, err := tier.Parse(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var user user_models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	from := tier.Normalize(string(user.Tier))
+	if from == target {
+		return nil, ErrTierUnchanged
+	}
+
+	apply := func(tx *gorm.DB, transactionID *uint) error {
+		var locked user_models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", userID).Error; err != nil {
+			return ErrUserNotFound
+		}
+		// The price was worked out from the tier read above.
+		if tier.Normalize(string(locked.Tier)) != from {
+			return ErrTierConflict
+		}
+
+		if err := tx.Model(&locked).Update("tier", target).Error; err != nil {
+			return err
+		}
+		locked.Tier = target
+		user = locked
+		return tx.Create(&user_models.TierChange{
+			UserID:        userID,
+			FromTier:      from,
+			ToTier:        target,
+			ActorID:       actorID,
+			Reason:        reason,
+			TransactionID: transactionID,
+		}).Error
+	}
+
+	upgrade := target.Rank() > from.Rank()
+	switch {
+	case charge && upgrade && s.billing == nil:
+		return nil, interfaces.ErrTierNotForSale
+	case charge && upgrade:
+		err = s.billing.ChargeUpgrade(userID, from, target, apply)
+	default:
+		err = s.db.Transaction(func(tx *gorm.DB) error { return apply(tx, nil) })
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionSvc.UpdateTier(userID, target); err != nil {
+		// The stored tier is right; sessions catch up at their next login.
+		log.Printf("failed to update sessions of %s to tier %s: %v", userID, target, err)
+	}
+	return &user, nil
+}
+
+// History returns the user's tier changes, newest first.
+func (s *TierService) History(userID uuid.UUID, limit int) ([]user_models.TierChange, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	var changes []user_models.TierChange
+	err := s.db.Where("user_id = ?", userID).Order("created_at desc, id desc").Limit(limit).Find(&changes).Error
+	return changes, err
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/totp"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrEnrollmentNotFound      = errors.New("no pending two-factor enrollment")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorLocked         = errors.New("too many invalid two-factor codes, try again later")
+	ErrChallengeNotFound       = errors.New("login challenge not found or expired")
+)
+
+const (
+	enrollmentTTL      = 10 * time.Minute
+	challengeTTL       = 5 * time.Minute
+	maxChallengeTries  = 5
+	maxCodeFailures    = 5
+	codeFailureWindow  = 15 * time.Minute
+	recoveryCodeCount  = 10
+	totpSkew           = 1 // accept the previous and next 30s step too
+	recoveryCodeLength = 10
+)
+
+// TwoFactorService manages TOTP enrollment, recovery codes, login
+// challenges and step-up checks. All time comes from clock.
+type TwoFactorService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	issuer      string
+	clock       totp.Clock
+}
+
+func NewTwoFactorService(db *gorm.DB, redisClient *redis.Client, issuer string, clock totp.Clock) *TwoFactorService {
+	return &TwoFactorService{
+		db:          db,
+		redisClient: redisClient,
+		issuer:      issuer,
+		clock:       clock,
+	}
+}
+
+// BeginEnrollment creates a secret for the user to add to an authenticator
+// app. Nothing changes for the user until ConfirmEnrollment proves the app
+// produces matching codes.
+func (s *TwoFactorService) BeginEnrollment(userID uuid.UUID) (*user_models.TOTPEnrollment, error) {
+	var user user_models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redisClient.Set(context.Background(), s.enrollmentKey(userID), secret, enrollmentTTL).Err(); err != nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	return &user_models.TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(secret, s.issuer, user.Email),
+	}, nil
+}
+
+// ConfirmEnrollment turns two-factor on once the user enters a valid code
+// from the new secret, and returns their recovery codes. The codes are only
+// ever shown here.
+func (s *TwoFactorService) ConfirmEnrollment(userID uuid.UUID, code string) ([]string, error) {
+	ctx := context.Background()
+	secret, err := s.redisClient.Get(ctx, s.enrollmentKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, ErrEnrollmentNotFound
+	}
+	if err != nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	counter, ok := totp.Validate(secret, normalizeCode(code), s.clock.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&user_models.User{}).
+			Where("id = ? AND totp_enabled = ?", userID, false).
+			Updates(map[string]interface{}{
+				"totp_secret":       secret,
+				"totp_enabled":      true,
+				"totp_last_counter": counter,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.redisClient.Del(ctx, s.enrollmentKey(userID))
+	return codes, nil
+}
+
+// Disable turns two-factor off after checking a current code.
+func (s *TwoFactorService) Disable(userID uuid.UUID, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user_models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"totp_secret":       "",
+				"totp_enabled":      false,
+				"totp_last_counter": 0,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&user_models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a
+// current code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Verify(userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Enabled reports whether the user has confirmed two-factor enrollment.
+func (s *TwoFactorService) Enabled(userID uuid.UUID) (bool, error) {
+	var user user_models.User
+	if err := s.db.Select("totp_enabled").First(&user, "id = ?", userID).Error; err != nil {
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+// Verify accepts a TOTP code or an unused recovery code. Each TOTP step and
+// each recovery code works once, and repeated failures lock the user out of
+// code checks for a while.
+func (s *TwoFactorService) Verify(userID uuid.UUID, code string) error {
+	ctx := context.Background()
+	failuresKey := s.failuresKey(userID)
+	if failures, _ := s.redisClient.Get(ctx, failuresKey).Int(); failures >= maxCodeFailures {
+		return ErrTwoFactorLocked
+	}
+
+	err := s.verifyCode(userID, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		pipe := s.redisClient.TxPipeline()
+		pipe.Incr(ctx, failuresKey)
+		pipe.Expire(ctx, failuresKey, codeFailureWindow)
+		pipe.Exec(ctx)
+		return err
+	}
+	if err == nil {
+		s.redisClient.Del(ctx, failuresKey)
+	}
+	return err
+}
+
+func (s *TwoFactorService) verifyCode(userID uuid.UUID, code string) error {
+	var user user_models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(user.TOTPSecret, code, s.clock.Now(), totpSkew)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		// Only move forward, so a code seen once cannot be used again.
+		result := s.db.Model(&user_models.User{}).
+			Where("id = ? AND totp_last_counter < ?", userID, counter).
+			Update("totp_last_counter", counter)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	result := s.db.Model(&user_models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", s.clock.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// StartChallenge parks a half-finished login until the second factor
+// arrives.
+func (s *TwoFactorService) StartChallenge(userID uuid.UUID, client user_models.ClientInfo) (*user_models.LoginChallenge, error) {
+	ctx := context.Background()
+	challengeID := uuid.NewString()
+	key := s.challengeKey(challengeID)
+
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"UserID":      userID.String(),
+			"IPAddress":   client.IPAddress,
+			"UserAgent":   client.UserAgent,
+			"DeviceLabel": client.DeviceLabel,
+			"Attempts":    0,
+		})
+		pipe.Expire(ctx, key, challengeTTL)
+		return nil
+	})
+	if err != nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	return &user_models.LoginChallenge{
+		ChallengeID: challengeID,
+		ExpiresAt:   s.clock.Now().Add(challengeTTL),
+	}, nil
+}
+
+// CompleteChallenge checks the second factor for a pending login and, on
+// success, consumes the challenge and returns who logged in from where.
+func (s *TwoFactorService) CompleteChallenge(challengeID, code string) (uuid.UUID, user_models.ClientInfo, error) {
+	ctx := context.Background()
+	key := s.challengeKey(challengeID)
+
+	pending, err := s.redisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return uuid.Nil, user_models.ClientInfo{}, ErrRedisUnavailable
+	}
+	userID, err := uuid.Parse(pending["UserID"])
+	if err != nil {
+		return uuid.Nil, user_models.ClientInfo{}, ErrChallengeNotFound
+	}
+
+	if err := s.Verify(userID, code); err != nil {
+		if attempts, _ := s.redisClient.HIncrBy(ctx, key, "Attempts", 1).Result(); attempts >= maxChallengeTries {
+			s.redisClient.Del(ctx, key)
+		}
+		return uuid.Nil, user_models.ClientInfo{}, err
+	}
+
+	// Only the request that deletes the challenge gets to use it.
+	if deleted, _ := s.redisClient.Del(ctx, key).Result(); deleted == 0 {
+		return uuid.Nil, user_models.ClientInfo{}, ErrChallengeNotFound
+	}
+
+	return userID, user_models.ClientInfo{
+		IPAddress:   pending["IPAddress"],
+		UserAgent:   pending["UserAgent"],
+		DeviceLabel: pending["DeviceLabel"],
+	}, nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&user_models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]user_models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		rows = append(rows, user_models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) enrollmentKey(userID uuid.UUID) string {
+	return "2fa:enroll:" + userID.String()
+}
+
+func (s *TwoFactorService) challengeKey(challengeID string) string {
+	return "2fa:challenge:" + challengeID
+}
+
+func (s *TwoFactorService) failuresKey(userID uuid.UUID) string {
+	return "2fa:failures:" + userID.String()
+}
+
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+	return code[:recoveryCodeLength], nil
+}
+
+// normalizeCode drops the spaces and dashes people type into codes.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return hex.EncodeToString(sum[:])
+}
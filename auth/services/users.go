@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRole = errors.New("invalid role")
+	ErrLastAdmin   = errors.New("cannot remove the last admin")
+)
+
+// ListUsers returns users whose email contains email and, if given, who
+// hold role.
+func (s *AuthService) ListUsers(email string, role string, limit, offset int) ([]user_models.User, error) {
+	query := s.db.Order("email")
+	if email != "" {
+		query = query.Where("LOWER(email) LIKE ?", "%"+strings.ToLower(email)+"%")
+	}
+	if role != "" {
+		query = query.Where("role = ?", strings.ToLower(role))
+	}
+	if limit == 0 {
+		limit = 50
+	}
+
+	var users []user_models.User
+	err := query.Limit(limit).Offset(offset).Find(&users).Error
+	return users, err
+}
+
+func (s *AuthService) GetUser(id uuid.UUID) (*user_models.User, error) {
+	var user user_models.User
+	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetRole changes a user's role and logs the user out everywhere, since
+// existing sessions carry the role they were issued with.
+func (s *AuthService) SetRole(id uuid.UUID, role string) (*user_models.User, error) {
+	newRole, ok := user_models.ParseRole(role)
+	if !ok {
+		return nil, ErrInvalidRole
+	}
+
+	var user user_models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		if user.Role == user_models.RoleAdmin && newRole != user_models.RoleAdmin {
+			// Lock every admin row so two demotions cannot both pass the check.
+			var admins []user_models.User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+				Where("role = ?", user_models.RoleAdmin).Find(&admins).Error; err != nil {
+				return err
+			}
+			if len(admins) <= 1 {
+				return ErrLastAdmin
+			}
+		}
+
+		user.Role = newRole
+		return tx.Model(&user).Update("role", newRole).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.sessionSvc.RevokeAllSessions(user.ID, ""); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UnlockUser lifts a failed-login lockout on the user's account.
+func (s *AuthService) UnlockUser(id uuid.UUID) (*user_models.User, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guard.Unlock(user.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// BootstrapAdmins grants the admin role to the users with the given emails,
+// so a fresh deployment has someone who can manage everyone else.
+func (s *AuthService) BootstrapAdmins(emails []string) (int64, error) {
+	var normalized []string
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			normalized = append(normalized, email)
+		}
+	}
+	if len(normalized) == 0 {
+		return 0, nil
+	}
+
+	result := s.db.Model(&user_models.User{}).
+		Where("LOWER(email) IN ? AND role <> ?", normalized, user_models.RoleAdmin).
+		Update("role", user_models.RoleAdmin)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// The RFC 6238 appendix B vectors are 8 digits; a 6 digit code is the last
+// six of them.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		clock := &fakeClock{now: time.Unix(v.unix, 0).UTC()}
+		code, err := Code(rfcSecret, clock.Now())
+		if err != nil {
+			t.Fatalf("Code at %d: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateMatchesRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		clock := &fakeClock{now: time.Unix(v.unix, 0).UTC()}
+		step, ok := Validate(rfcSecret, v.code, clock.Now(), 0)
+		if !ok {
+			t.Errorf("Validate at %d rejected %s", v.unix, v.code)
+			continue
+		}
+		if want := Counter(clock.Now()); step != want {
+			t.Errorf("Validate at %d matched step %d, want %d", v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1111111111, 0).UTC()}
+	code, err := Code(rfcSecret, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(Period)
+	if _, ok := Validate(rfcSecret, code, clock.Now(), 1); !ok {
+		t.Error("code from the previous step rejected with skew 1")
+	}
+	if _, ok := Validate(rfcSecret, code, clock.Now(), 0); ok {
+		t.Error("code from the previous step accepted with skew 0")
+	}
+
+	clock.Advance(Period)
+	if _, ok := Validate(rfcSecret, code, clock.Now(), 1); ok {
+		t.Error("code from two steps back accepted with skew 1")
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tc := range []struct{ secret, code string }{
+		{rfcSecret, "28708"},
+		{rfcSecret, "2870820"},
+		{"not base32!", "287082"},
+		{"", "287082"},
+	} {
+		if _, ok := Validate(tc.secret, tc.code, now, 1); ok {
+			t.Errorf("Validate(%q, %q) accepted", tc.secret, tc.code)
+		}
+	}
+}
@@ -18,9 +18,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata" // fee peak windows are defined in IANA timezones
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
@@ -30,14 +34,29 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/nazrawigedion123/wallet-backend/auth/handlers"
+	"github.com/nazrawigedion123/wallet-backend/auth/keyring"
+	"github.com/nazrawigedion123/wallet-backend/auth/oidc"
 	"github.com/nazrawigedion123/wallet-backend/auth/services"
+	"github.com/nazrawigedion123/wallet-backend/auth/totp"
+	"github.com/nazrawigedion123/wallet-backend/blobstore"
+	"github.com/nazrawigedion123/wallet-backend/health"
+	ledgerService "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/lifecycle"
+	"github.com/nazrawigedion123/wallet-backend/mailer"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/outbox"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 	db "github.com/nazrawigedion123/wallet-backend/utils"
 
 	_ "github.com/nazrawigedion123/wallet-backend/docs"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
 	authRoutes "github.com/nazrawigedion123/wallet-backend/auth/routes"
+	kycHandlers "github.com/nazrawigedion123/wallet-backend/kyc/handlers"
+	kycRoutes "github.com/nazrawigedion123/wallet-backend/kyc/routes"
+	kycServices "github.com/nazrawigedion123/wallet-backend/kyc/services"
 	walletHandler "github.com/nazrawigedion123/wallet-backend/wallet/handlers"
+	"github.com/nazrawigedion123/wallet-backend/wallet/interfaces"
 	walletRoutes "github.com/nazrawigedion123/wallet-backend/wallet/routes"
 	walletService "github.com/nazrawigedion123/wallet-backend/wallet/services"
 	webHookHandler "github.com/nazrawigedion123/wallet-backend/webhook/handlers"
@@ -56,28 +75,71 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("⚠️  No .env file found or failed to load")
 	}
+	// SHUTDOWN_TIMEOUT bounds a graceful stop; SHUTDOWN_DRAIN_DELAY keeps
+	// serving that long after turning not-ready, for load balancers.
+	app := lifecycle.NewManager(lifecycle.Config{
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", lifecycle.DefaultConfig.ShutdownTimeout),
+		DrainDelay:      envDuration("SHUTDOWN_DRAIN_DELAY", lifecycle.DefaultConfig.DrainDelay),
+	})
+
 	if err := initDatabase(); err != nil {
 		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
-	defer db.CloseConnections()
-
 	if err := initRedis(); err != nil {
 		log.Fatalf("❌ Failed to connect to Redis: %v", err)
 	}
+	app.OnClose("connections", func() error {
+		db.CloseConnections()
+		return redisClient.Close()
+	})
+
+	//auth
+	mail := initMailer()
+	accessTTL := envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	refreshTTL := envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	keys := initKeyRing(app, refreshTTL)
+	sessionSvc, authSvc, twoFactorSvc := initServices(keys, accessTTL, refreshTTL, mail)
+	accountSvc := services.NewAccountService(db.DB, sessionSvc, mail, os.Getenv("MAIL_FROM"), os.Getenv("APP_BASE_URL"))
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("❌ JWT_SECRET environment variable is not set")
+	//kyc
+	kycStorage := os.Getenv("KYC_STORAGE_DIR")
+	if kycStorage == "" {
+		kycStorage = "storage"
 	}
+	kycStore, err := blobstore.NewLocalStore(kycStorage)
+	if err != nil {
+		log.Fatalf("❌ Failed to open KYC document storage: %v", err)
+	}
+	kycSvc := kycServices.NewKYCService(db.DB, kycStore)
 
-	//auth
-	sessionSvc, authSvc := initServices(jwtSecret)
-	authHandler := handlers.NewAuthHandler(authSvc, sessionSvc)
+	//wallet
+	relay := initOutbox(app)
+	ledgerSvc := ledgerService.NewLedgerService(db.DB)
+	fees := initFees(app)
+	limits := walletService.NewLimitService(db.DB, redisClient, kycSvc)
+	if err := limits.SeedDefaults(); err != nil {
+		log.Printf("⚠️  Failed to seed transaction limits: %v", err)
+	}
+	ws := walletService.NewWalletService(db.DB, redisClient, ledgerSvc, fees, limits, twoFactorSvc, stepUpLimits())
+	reconcileLedger(ws)
+	walletHandlerInstance := &walletHandler.WalletHandler{
+		WalletService: ws,
+		FXService:     initFX(ws),
+		FeeService:    fees,
+		LimitService:  limits,
+		Tasks:         app,
+	}
+
+	tierSvc := services.NewTierService(db.DB, sessionSvc, walletService.NewTierBilling(ws, tierPrices()))
+	authHandler := handlers.NewAuthHandler(authSvc, sessionSvc, twoFactorSvc, accountSvc, tierSvc)
+	adminHandler := handlers.NewAdminHandler(authSvc, tierSvc)
 
-	e := setupServer(authHandler, sessionSvc)
+	apiKeySvc := services.NewAPIKeyService(db.DB)
+	e := setupServer(authHandler, adminHandler, initOIDC(sessionSvc, twoFactorSvc), handlers.NewAPIKeyHandler(apiKeySvc), handlers.NewKeysHandler(keys), walletHandlerInstance, kycHandlers.NewKYCHandler(kycSvc), initHealth(app, keys, relay), sessionSvc, apiKeySvc, ledgerSvc)
 
+	app.Serve("http server", func() error { return e.Start(":8080") }, e.Shutdown)
 	log.Println("🚀 Server started on :8080")
-	e.Logger.Fatal(e.Start(":8080"))
+	app.Wait()
 }
 
 func initDatabase() error {
@@ -99,34 +161,89 @@ func initRedis() error {
 	return db.InitRedis()
 }
 
-func initServices(jwtSecret string) (*services.SessionService, *services.AuthService) {
-	sessionSvc := services.NewSessionService(db.RedisClient, jwtSecret, 24*time.Hour)
-	authSvc := services.NewAuthService(db.DB, sessionSvc)
-	return sessionSvc, authSvc
+// initKeyRing loads the token signing keys shared through Redis, creating
+// the first one if needed, and rotates them every JWT_ROTATION_INTERVAL
+// (default 720h). JWT_SIGNING_ALG is RS256 (default) or EdDSA. A replaced
+// key keeps verifying for as long as a refresh token lives.
+func initKeyRing(app *lifecycle.Manager, refreshTTL time.Duration) *keyring.KeyRing {
+	alg, err := keyring.ParseAlgorithm(os.Getenv("JWT_SIGNING_ALG"))
+	if err != nil {
+		log.Fatalf("❌ Invalid JWT_SIGNING_ALG: %v", err)
+	}
+	config := keyring.Config{
+		Algorithm:        alg,
+		RotationInterval: envDuration("JWT_ROTATION_INTERVAL", 30*24*time.Hour),
+		RetireAfter:      refreshTTL,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	keys, err := keyring.NewKeyRing(ctx, keyring.NewRedisStore(db.RedisClient, "jwt:keyring"), config)
+	if err != nil {
+		log.Fatalf("❌ Failed to load token signing keys: %v", err)
+	}
+	app.Start("key ring", func(ctx context.Context) { keys.Run(ctx, time.Minute) })
+	return keys
+}
+
+// initServices sets up sessions, login and two-factor. JWT_SECRET, if set,
+// keeps HS256 tokens issued before signing keys were introduced valid until
+// they expire.
+func initServices(keys *keyring.KeyRing, accessTTL, refreshTTL time.Duration, mail mailer.Mailer) (*services.SessionService, *services.AuthService, *services.TwoFactorService) {
+	sessionSvc := services.NewSessionService(db.RedisClient, keys, os.Getenv("JWT_SECRET"), accessTTL, refreshTTL)
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Wallet"
+	}
+	twoFactorSvc := services.NewTwoFactorService(db.DB, db.RedisClient, issuer, totp.SystemClock{})
+	guard := services.NewLoginGuard(db.RedisClient, services.DefaultLoginGuardConfig, mail, os.Getenv("MAIL_FROM"))
+	authSvc := services.NewAuthService(db.DB, sessionSvc, twoFactorSvc, guard)
+
+	// ADMIN_EMAILS is a comma-separated list of users to promote to admin.
+	promoted, err := authSvc.BootstrapAdmins(strings.Split(os.Getenv("ADMIN_EMAILS"), ","))
+	if err != nil {
+		log.Printf("⚠️  Failed to bootstrap admins: %v", err)
+	} else if promoted > 0 {
+		log.Printf("🔑 Promoted %d users to admin", promoted)
+	}
+	return sessionSvc, authSvc, twoFactorSvc
 }
 
-func setupServer(authHandler *handlers.AuthHandler, sessionSvc *services.SessionService) *echo.Echo {
+func setupServer(authHandler *handlers.AuthHandler, adminHandler *handlers.AdminHandler, oidcHandler *handlers.OIDCHandler, apiKeyHandler *handlers.APIKeyHandler, keysHandler *handlers.KeysHandler, walletHandlerInstance *walletHandler.WalletHandler, kycHandler *kycHandlers.KYCHandler, healthHandler *health.Handler, sessionSvc *services.SessionService, apiKeySvc *services.APIKeyService, ledgerSvc *ledgerService.LedgerService) *echo.Echo {
 	e := echo.New()
-	e.Use(middleware.Logger())
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		// Probes hit these every few seconds.
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/healthz" || c.Path() == "/readyz"
+		},
+	}))
 	e.Use(middleware.Recover())
 
 	// Add Swagger route
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	authRoutes.RegisterJWKSRoutes(e, keysHandler)
+	health.RegisterRoutes(e, healthHandler)
 	apiGroup := e.Group("/api")
 	e.Validator = &db.CustomValidator{Validator: validator.New()}
 
 	authRoutes.RegisterAuthRoutes(apiGroup, authHandler, sessionSvc)
-
-	ws := walletService.NewWalletService(db.DB, redisClient)
-	walletHandlerInstance := &walletHandler.WalletHandler{
-		WalletService: ws,
+	authRoutes.RegisterAdminRoutes(apiGroup, adminHandler, sessionSvc)
+	authRoutes.RegisterAPIKeyRoutes(apiGroup, apiKeyHandler, sessionSvc)
+	if oidcHandler != nil {
+		authRoutes.RegisterOIDCRoutes(apiGroup, oidcHandler)
 	}
 
-	walletRoutes.RegisterWalletRoutes(apiGroup, walletHandlerInstance, sessionSvc)
-	walletRoutes.RegisterSimulationRoutes(apiGroup, walletHandlerInstance)
+	walletRoutes.RegisterWalletRoutes(apiGroup, walletHandlerInstance, sessionSvc, apiKeySvc, redisClient)
+	walletRoutes.RegisterFeeAdminRoutes(apiGroup, walletHandlerInstance, sessionSvc)
+	walletRoutes.RegisterLimitAdminRoutes(apiGroup, walletHandlerInstance, sessionSvc)
+	walletRoutes.RegisterSimulationRoutes(apiGroup, walletHandlerInstance, sessionSvc)
+
+	kycRoutes.RegisterKYCRoutes(apiGroup, kycHandler, sessionSvc)
+	kycRoutes.RegisterKYCAdminRoutes(apiGroup, kycHandler, sessionSvc)
 
 	// Update the webhook handler initialization
-	webhookSvc := webHookService.NewWebhookService(redisClient, db.DB)
+	webhookSvc := webHookService.NewWebhookService(redisClient, db.DB, ledgerSvc)
 	webhookHandlerInstance := webHookHandler.NewWebhookHandler(webhookSvc)
 	webHookRoutes.RegisterWebhookRoutes(apiGroup, webhookHandlerInstance)
 
@@ -134,3 +251,233 @@ func setupServer(authHandler *handlers.AuthHandler, sessionSvc *services.Session
 
 	return e
 }
+
+// reconcileLedger backfills opening entries for pre-ledger wallets and logs
+// any wallet whose balance no longer matches its postings.
+func reconcileLedger(ws *walletService.WalletService) {
+	backfilled, err := ws.BackfillOpeningBalances()
+	if err != nil {
+		log.Printf("⚠️  Failed to backfill opening balances: %v", err)
+		return
+	}
+	if backfilled > 0 {
+		log.Printf("📒 Posted opening balances for %d wallets", backfilled)
+	}
+
+	discrepancies, err := ws.Reconcile()
+	if err != nil {
+		log.Printf("⚠️  Ledger reconciliation failed: %v", err)
+		return
+	}
+	for _, d := range discrepancies {
+		log.Printf("⚠️  Wallet %s balance %s does not match ledger %s", d.UserID, d.WalletBalance, d.LedgerBalance)
+	}
+}
+
+// initFees seeds the default fee schedule on first start, loads every fee
+// rule version into memory and keeps it in sync with admin changes made on
+// any instance. Without the rules every transaction would be free, so
+// startup fails if they cannot be seeded or loaded. Fee quotes are signed with FEE_QUOTE_SECRET (JWT_SECRET if
+// unset) and last FEE_QUOTE_TTL (default 2m).
+func initFees(app *lifecycle.Manager) *walletService.FeeService {
+	quoteSecret := os.Getenv("FEE_QUOTE_SECRET")
+	if quoteSecret == "" {
+		quoteSecret = os.Getenv("JWT_SECRET")
+	}
+	if quoteSecret == "" {
+		log.Fatal("❌ FEE_QUOTE_SECRET environment variable is not set")
+	}
+	quoteTTL := envDuration("FEE_QUOTE_TTL", 2*time.Minute)
+
+	fees := walletService.NewFeeService(db.DB, redisClient, quoteSecret, quoteTTL)
+	if err := fees.SeedDefaults(); err != nil {
+		log.Fatalf("❌ Failed to seed fee configs: %v", err)
+	}
+	if err := fees.Reload(); err != nil {
+		log.Fatalf("❌ Failed to load fee configs: %v", err)
+	}
+	app.Start("fee reloads", fees.WatchReloads)
+	return fees
+}
+
+// initFX loads exchange rates from FX_RATES_FILE (default wallet/fx_rates.json)
+// and reads the spread and quote lifetime from the environment.
+func initFX(ws *walletService.WalletService) *walletService.FXService {
+	ratesFile := os.Getenv("FX_RATES_FILE")
+	if ratesFile == "" {
+		ratesFile = "wallet/fx_rates.json"
+	}
+
+	var rates interfaces.RateProvider
+	provider, err := walletService.NewFileRateProvider(ratesFile)
+	if err != nil {
+		log.Printf("⚠️  Failed to load FX rates, conversions are disabled: %v", err)
+		rates, _ = walletService.NewStaticRateProvider(nil)
+	} else {
+		rates = provider
+	}
+
+	spread := 0.5
+	if v := os.Getenv("FX_SPREAD_PERCENT"); v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+			spread = parsed
+		}
+	}
+
+	quoteTTL := envDuration("FX_QUOTE_TTL", 30*time.Second)
+
+	return walletService.NewFXService(ws, rates, spread, quoteTTL)
+}
+
+// initMailer picks where outbound mail goes: MAIL_DIR writes each message
+// to a file there. Logging in needs a verified email, so without a mailer
+// that delivers nobody new could ever log in, and startup fails instead.
+func initMailer() mailer.Mailer {
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		log.Fatal("❌ MAIL_DIR must be set: users cannot verify their email without outbound mail")
+	}
+
+	m, err := mailer.NewFileMailer(dir)
+	if err != nil {
+		log.Fatalf("❌ Failed to set up outbound mail: %v", err)
+	}
+	log.Printf("📧 Writing outbound mail to %s", dir)
+	return m
+}
+
+// initOutbox starts relaying wallet events to Redis streams named
+// OUTBOX_STREAM_PREFIX (default "events:") plus the topic, each trimmed to
+// about OUTBOX_STREAM_MAXLEN (default 100000) entries.
+func initOutbox(app *lifecycle.Manager) *outbox.Relay {
+	prefix := os.Getenv("OUTBOX_STREAM_PREFIX")
+	if prefix == "" {
+		prefix = "events:"
+	}
+	maxLen, err := strconv.ParseInt(os.Getenv("OUTBOX_STREAM_MAXLEN"), 10, 64)
+	if err != nil {
+		maxLen = 100000
+	}
+
+	relay := outbox.NewRelay(db.DB, outbox.NewRedisStreamPublisher(redisClient, prefix, maxLen), outbox.DefaultRelayConfig)
+	app.Start("outbox relay", relay.Run)
+	return relay
+}
+
+// initHealth sets up the readiness checks. Postgres and Redis are critical;
+// stalled workers and an outbox whose oldest pending message has waited
+// longer than OUTBOX_MAX_LAG (default 1m) only mark the instance degraded.
+func initHealth(app *lifecycle.Manager, keys *keyring.KeyRing, relay *outbox.Relay) *health.Handler {
+	checker := health.NewChecker(app.Ready, 2*time.Second)
+	checker.Add("postgres", true, health.Postgres(db.DB))
+	checker.Add("redis", true, health.Redis(db.RedisClient))
+	checker.Add("workers", false, health.Running(app.Stopped))
+	checker.Add("key_ring", false, health.Heartbeat(keys.LoadedAt, 3*time.Minute))
+	checker.Add("outbox_relay", false, health.Heartbeat(relay.LastRound, time.Minute))
+	checker.Add("outbox_lag", false, health.Lag(relay.Lag, envDuration("OUTBOX_MAX_LAG", time.Minute)))
+	return health.NewHandler(checker)
+}
+
+// initOIDC sets up single sign-on against OIDC_ISSUER_URL, or returns nil
+// when it is unset or the provider cannot be reached. OIDC_AUTO_PROVISION
+// creates accounts for verified emails that have none.
+func initOIDC(sessionSvc *services.SessionService, twoFactorSvc *services.TwoFactorService) *handlers.OIDCHandler {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil
+	}
+
+	config := oidc.Config{
+		IssuerURL:    issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_SCOPES"), ",", " ")),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, config, nil)
+	if err != nil {
+		log.Printf("⚠️  Single sign-on disabled: %v", err)
+		return nil
+	}
+
+	autoProvision, _ := strconv.ParseBool(os.Getenv("OIDC_AUTO_PROVISION"))
+	log.Printf("🔐 Single sign-on enabled with %s", issuer)
+	return handlers.NewOIDCHandler(services.NewOIDCService(db.DB, db.RedisClient, provider, sessionSvc, twoFactorSvc, autoProvision))
+}
+
+// stepUpLimits reads STEP_UP_WITHDRAW_LIMITS, e.g. "USD=1000.00,EUR=900.00":
+// withdrawals, transfers and conversions above the limit for their currency
+// need a two-factor code.
+func stepUpLimits() map[string]money.Amount {
+	limits := map[string]money.Amount{}
+	for name, limit := range envAmounts("STEP_UP_WITHDRAW_LIMITS", "USD=1000.00") {
+		currency, err := money.NormalizeCurrency(name)
+		if err != nil {
+			log.Printf("⚠️  Ignoring step-up limit for %q: %v", name, err)
+			continue
+		}
+		limits[currency] = limit
+	}
+	return limits
+}
+
+// tierPrices reads TIER_PRICES, e.g. "premium=9.99,enterprise=49.99": an
+// upgrade costs the difference between the two tiers' prices in USD. Users
+// cannot upgrade themselves to a tier without a price; set it to 0 to make
+// the tier free.
+func tierPrices() map[tier.Tier]money.Amount {
+	prices := map[tier.Tier]money.Amount{}
+	for name, price := range envAmounts("TIER_PRICES", "") {
+		t, err := tier.Parse(name)
+		if err != nil {
+			log.Printf("⚠️  Ignoring tier price: %v", err)
+			continue
+		}
+		prices[t] = price
+	}
+	return prices
+}
+
+// envAmounts reads a "key=amount,..." list from the environment.
+func envAmounts(name, def string) map[string]money.Amount {
+	spec := os.Getenv(name)
+	if spec == "" {
+		spec = def
+	}
+
+	amounts := map[string]money.Amount{}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			log.Printf("⚠️  Ignoring invalid %s entry %q", name, entry)
+			continue
+		}
+		amount, err := money.Parse(strings.TrimSpace(value))
+		if err != nil {
+			log.Printf("⚠️  Ignoring %s entry %q: %v", name, entry, err)
+			continue
+		}
+		amounts[strings.TrimSpace(key)] = amount
+	}
+	return amounts
+}
+
+// envDuration reads a duration such as "15m" from the environment, falling
+// back to def when the variable is unset or malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed <= 0 {
+		log.Printf("⚠️  Ignoring invalid %s=%q, using %s", name, v, def)
+		return def
+	}
+	return parsed
+}
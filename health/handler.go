@@ -0,0 +1,56 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handler serves the probe endpoints
+type Handler struct {
+	checker *Checker
+}
+
+func NewHandler(checker *Checker) *Handler {
+	return &Handler{
+		checker: checker,
+	}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Succeeds while the process is running. It checks no dependencies, so a database outage never gets the process restarted.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (h *Handler) Liveness(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Checks Postgres, Redis, background workers and outbox lag, with the status and latency of each. Fails while shutting down or when a critical dependency is down; non-critical failures report degraded.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *Handler) Readiness(c echo.Context) error {
+	report := h.checker.Check(c.Request().Context())
+
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(status, report)
+}
+
+// RegisterRoutes serves the probes at the root, outside /api, where
+// Kubernetes and load balancers expect them.
+func RegisterRoutes(e *echo.Echo, h *Handler) {
+	e.GET("/healthz", h.Liveness)
+	e.GET("/readyz", h.Readiness)
+}
@@ -0,0 +1,175 @@
+// Package health answers liveness and readiness probes. Liveness only says
+// the process is up; readiness runs every registered check and fails if a
+// critical one does, or while the process is shutting down. Non-critical
+// checks, such as a stalled worker, mark the report degraded without
+// taking the instance out of rotation.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusFail     Status = "fail"
+)
+
+// CheckFunc returns nil when the component is healthy.
+type CheckFunc func(ctx context.Context) error
+
+// Component is the outcome of one check.
+type Component struct {
+	Status    Status  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check.
+type Report struct {
+	Status     Status               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+type check struct {
+	name     string
+	critical bool
+	run      CheckFunc
+}
+
+// Checker runs the readiness checks. ready reports whether the process is
+// serving; while it is false readiness fails whatever the checks say.
+type Checker struct {
+	ready   func() bool
+	timeout time.Duration
+	checks  []check
+}
+
+func NewChecker(ready func() bool, timeout time.Duration) *Checker {
+	return &Checker{ready: ready, timeout: timeout}
+}
+
+// Add registers a check. A failing critical check fails readiness.
+func (c *Checker) Add(name string, critical bool, run CheckFunc) {
+	c.checks = append(c.checks, check{name: name, critical: critical, run: run})
+}
+
+// Check runs every check at once, each bounded by the checker's timeout.
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Components: make(map[string]Component, len(c.checks)+1)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func(chk check) {
+			defer wg.Done()
+			component := c.run(ctx, chk)
+			mu.Lock()
+			report.Components[chk.name] = component
+			mu.Unlock()
+		}(chk)
+	}
+	wg.Wait()
+
+	if !c.ready() {
+		report.Components["lifecycle"] = Component{Status: StatusFail, Critical: true, Error: "not serving or shutting down"}
+	}
+	for _, component := range report.Components {
+		switch {
+		case component.Status == StatusOK:
+		case component.Critical:
+			report.Status = StatusFail
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, chk check) (component Component) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			component = Component{Status: StatusFail, Critical: chk.critical, Error: fmt.Sprintf("check panicked: %v", r)}
+		}
+		component.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	if err := chk.run(ctx); err != nil {
+		return Component{Status: StatusFail, Critical: chk.critical, Error: err.Error()}
+	}
+	return Component{Status: StatusOK, Critical: chk.critical}
+}
+
+// Postgres pings the database.
+func Postgres(db *gorm.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Redis pings a Redis server.
+func Redis(client *redis.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// Lag fails when measure reports something has been waiting longer than
+// max, such as the oldest unpublished outbox message.
+func Lag(measure func(ctx context.Context) (time.Duration, error), max time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		lag, err := measure(ctx)
+		if err != nil {
+			return err
+		}
+		if lag > max {
+			return fmt.Errorf("lagging %s behind, more than %s", lag.Round(time.Second), max)
+		}
+		return nil
+	}
+}
+
+// Heartbeat fails when last, the time a worker last reported progress, is
+// older than maxAge.
+func Heartbeat(last func() time.Time, maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		beat := last()
+		if beat.IsZero() {
+			return errors.New("no heartbeat yet")
+		}
+		if age := time.Since(beat); age > maxAge {
+			return fmt.Errorf("last heartbeat %s ago, more than %s", age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
+
+// Running fails when stopped lists any workers.
+func Running(stopped func() []string) CheckFunc {
+	return func(ctx context.Context) error {
+		if names := stopped(); len(names) > 0 {
+			return fmt.Errorf("stopped: %s", strings.Join(names, ", "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/kyc/models"
+	"github.com/nazrawigedion123/wallet-backend/kyc/services"
+)
+
+type KYCHandler struct {
+	KYCService *services.KYCService
+}
+
+// ApproveRequest grants a verification level (1 identity, 2 identity and
+// address).
+type ApproveRequest struct {
+	Level int `json:"level" validate:"required,min=1,max=2"`
+}
+
+type RejectRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+func NewKYCHandler(kycService *services.KYCService) *KYCHandler {
+	return &KYCHandler{
+		KYCService: kycService,
+	}
+}
+
+func (h *KYCHandler) GetProfile(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	profile, err := h.KYCService.GetProfile(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch verification status")
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+// UploadDocument takes a multipart form with a "type" field and a "file".
+func (h *KYCHandler) UploadDocument(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	// Leave room for the multipart framing around the file.
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, services.MaxDocumentSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "a file is required")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "could not read file")
+	}
+	defer file.Close()
+
+	doc, err := h.KYCService.UploadDocument(userID, models.DocumentType(c.FormValue("type")), header.Filename, file)
+	if err != nil {
+		return kycError(err)
+	}
+
+	return c.JSON(http.StatusCreated, doc)
+}
+
+func (h *KYCHandler) Submit(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	profile, err := h.KYCService.Submit(userID)
+	if err != nil {
+		return kycError(err)
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+func (h *KYCHandler) ListProfiles(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+
+	profiles, err := h.KYCService.ListProfiles(c.QueryParam("status"), limit, offset)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch verification profiles")
+	}
+
+	return c.JSON(http.StatusOK, profiles)
+}
+
+func (h *KYCHandler) GetUserProfile(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	profile, err := h.KYCService.GetProfile(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch verification status")
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+func (h *KYCHandler) DownloadDocument(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid document id")
+	}
+
+	doc, r, err := h.KYCService.OpenDocument(id)
+	if err != nil {
+		return kycError(err)
+	}
+	defer r.Close()
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename="+strconv.Quote(doc.FileName))
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(doc.Size, 10))
+	c.Response().Header().Set(echo.HeaderContentType, doc.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = io.Copy(c.Response(), r)
+	return err
+}
+
+func (h *KYCHandler) Approve(c echo.Context) error {
+	reviewerID := c.Get("userID").(uuid.UUID)
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	var req ApproveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	profile, err := h.KYCService.Approve(userID, reviewerID, req.Level)
+	if err != nil {
+		return kycError(err)
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+func (h *KYCHandler) Reject(c echo.Context) error {
+	reviewerID := c.Get("userID").(uuid.UUID)
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	var req RejectRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	profile, err := h.KYCService.Reject(userID, reviewerID, req.Reason)
+	if err != nil {
+		return kycError(err)
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+func kycError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidDocument), errors.Is(err, services.ErrMissingDocuments):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrDocumentTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, services.ErrDocumentNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidTransition):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusUnverified Status = "unverified"
+	StatusPending    Status = "pending"
+	StatusVerified   Status = "verified"
+	StatusRejected   Status = "rejected"
+)
+
+// Verification levels. A verified profile is at least LevelIdentity; the
+// reviewer grants LevelAddress once proof of address has been checked too.
+const (
+	LevelNone     = 0
+	LevelIdentity = 1
+	LevelAddress  = 2
+)
+
+type DocumentType string
+
+const (
+	DocumentPassport       DocumentType = "passport"
+	DocumentNationalID     DocumentType = "national_id"
+	DocumentDriversLicense DocumentType = "drivers_license"
+	DocumentProofOfAddress DocumentType = "proof_of_address"
+	DocumentSelfie         DocumentType = "selfie"
+)
+
+// IdentityDocuments are the document types that prove who the user is. A
+// profile needs one of them before it can be submitted for review.
+var IdentityDocuments = []DocumentType{DocumentPassport, DocumentNationalID, DocumentDriversLicense}
+
+// DocumentTypes lists every accepted document type.
+var DocumentTypes = append(append([]DocumentType{}, IdentityDocuments...), DocumentProofOfAddress, DocumentSelfie)
+
+// Profile is a user's identity verification state. Users without a row are
+// unverified.
+type Profile struct {
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Status Status    `json:"status" gorm:"type:varchar(20);not null;default:'unverified';index"`
+	// Level is the level granted by the last approval. It is kept while a
+	// request for a higher level is pending.
+	Level           int        `json:"level" gorm:"not null;default:0"`
+	SubmittedAt     *time.Time `json:"submitted_at,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	ReviewerID      *uuid.UUID `json:"reviewer_id,omitempty" gorm:"type:uuid"`
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Documents []Document `json:"documents" gorm:"foreignKey:UserID;references:UserID"`
+}
+
+func (Profile) TableName() string {
+	return "kyc_profiles"
+}
+
+// Document is the metadata of an uploaded file; the file itself lives in
+// the blob store under StorageKey.
+type Document struct {
+	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID    `json:"user_id" gorm:"type:uuid;not null;index"`
+	Type        DocumentType `json:"type" gorm:"type:varchar(30);not null"`
+	FileName    string       `json:"file_name" gorm:"not null"`
+	ContentType string       `json:"content_type" gorm:"not null"`
+	Size        int64        `json:"size" gorm:"not null"`
+	SHA256      string       `json:"sha256" gorm:"type:varchar(64);not null"`
+	StorageKey  string       `json:"-" gorm:"not null"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+func (Document) TableName() string {
+	return "kyc_documents"
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/auth/services"
+	"github.com/nazrawigedion123/wallet-backend/kyc/handlers"
+)
+
+func RegisterKYCRoutes(e *echo.Group, kycHandler *handlers.KYCHandler, sessionSvc *services.SessionService) {
+	kycGroup := e.Group("/kyc")
+	kycGroup.Use(middleware.AuthMiddleware(sessionSvc))
+
+	kycGroup.GET("", kycHandler.GetProfile)
+	kycGroup.POST("/documents", kycHandler.UploadDocument)
+	kycGroup.POST("/submit", kycHandler.Submit)
+}
+
+// RegisterKYCAdminRoutes exposes the verification review queue to staff roles.
+func RegisterKYCAdminRoutes(e *echo.Group, kycHandler *handlers.KYCHandler, sessionSvc *services.SessionService) {
+	adminGroup := e.Group("/admin/kyc")
+	adminGroup.Use(middleware.AuthMiddleware(sessionSvc))
+	canView := middleware.RequirePermission(models.PermViewKYC)
+	canReview := middleware.RequirePermission(models.PermReviewKYC)
+
+	adminGroup.GET("", kycHandler.ListProfiles, canView)
+	adminGroup.GET("/documents/:id", kycHandler.DownloadDocument, canView)
+	adminGroup.GET("/:user_id", kycHandler.GetUserProfile, canView)
+	adminGroup.POST("/:user_id/approve", kycHandler.Approve, canReview)
+	adminGroup.POST("/:user_id/reject", kycHandler.Reject, canReview)
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/blobstore"
+	"github.com/nazrawigedion123/wallet-backend/kyc/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidDocument   = errors.New("invalid document")
+	ErrDocumentTooLarge  = errors.New("document is too large")
+	ErrDocumentNotFound  = errors.New("document not found")
+	ErrMissingDocuments  = errors.New("missing required documents")
+	ErrInvalidTransition = errors.New("invalid verification state")
+)
+
+// MaxDocumentSize is the largest file accepted as a document.
+const MaxDocumentSize = 10 << 20
+
+// allowedContentTypes are sniffed from the file itself; the type the client
+// claims is ignored.
+var allowedContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"application/pdf": true,
+}
+
+// KYCService tracks identity verification: users upload documents and
+// submit them, staff approve or reject, and the wallet asks for the level
+// that was granted.
+type KYCService struct {
+	db    *gorm.DB
+	store blobstore.Store
+}
+
+func NewKYCService(db *gorm.DB, store blobstore.Store) *KYCService {
+	return &KYCService{
+		db:    db,
+		store: store,
+	}
+}
+
+// GetProfile returns the user's verification state and documents. Users
+// who never started verification get an unverified profile.
+func (s *KYCService) GetProfile(userID uuid.UUID) (*models.Profile, error) {
+	profile := models.Profile{UserID: userID, Status: models.StatusUnverified}
+	err := s.db.Preload("Documents", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		First(&profile, "user_id = ?", userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if profile.Documents == nil {
+		if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&profile.Documents).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &profile, nil
+}
+
+// Level returns the verification level the user holds. A verified user who
+// has submitted again for a higher level keeps their level while the
+// request waits for review.
+func (s *KYCService) Level(userID uuid.UUID) (int, error) {
+	var profile models.Profile
+	err := s.db.Select("status", "level").First(&profile, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.LevelNone, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch profile.Status {
+	case models.StatusVerified, models.StatusPending:
+		return profile.Level, nil
+	default:
+		return models.LevelNone, nil
+	}
+}
+
+// UploadDocument stores a document for the user. Documents cannot be added
+// while a submission is waiting for review.
+func (s *KYCService) UploadDocument(userID uuid.UUID, docType models.DocumentType, fileName string, r io.Reader) (*models.Document, error) {
+	if !containsDocumentType(models.DocumentTypes, docType) {
+		return nil, fmt.Errorf("%w: unknown document type %q", ErrInvalidDocument, docType)
+	}
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Status == models.StatusPending {
+		return nil, fmt.Errorf("%w: documents cannot change while under review", ErrInvalidTransition)
+	}
+
+	buffered := bufio.NewReaderSize(r, 512)
+	head, _ := buffered.Peek(512)
+	contentType := http.DetectContentType(head)
+	if !allowedContentTypes[contentType] {
+		return nil, fmt.Errorf("%w: %s files are not accepted", ErrInvalidDocument, contentType)
+	}
+
+	doc := models.Document{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Type:        docType,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+	}
+	doc.StorageKey = fmt.Sprintf("kyc/%s/%s", userID, doc.ID)
+
+	hash := sha256.New()
+	limited := io.LimitReader(io.TeeReader(buffered, hash), MaxDocumentSize+1)
+	ctx := context.Background()
+	size, err := s.store.Put(ctx, doc.StorageKey, limited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store document: %v", err)
+	}
+	if size > MaxDocumentSize {
+		s.store.Delete(ctx, doc.StorageKey)
+		return nil, ErrDocumentTooLarge
+	}
+	doc.Size = size
+	doc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.db.Create(&doc).Error; err != nil {
+		s.store.Delete(ctx, doc.StorageKey)
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// OpenDocument returns a document and its contents. The caller closes the
+// reader.
+func (s *KYCService) OpenDocument(id uuid.UUID) (*models.Document, io.ReadCloser, error) {
+	var doc models.Document
+	if err := s.db.First(&doc, "id = ?", id).Error; err != nil {
+		return nil, nil, ErrDocumentNotFound
+	}
+	r, err := s.store.Open(context.Background(), doc.StorageKey)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &doc, r, nil
+}
+
+// Submit puts the user's documents up for review. Verified users can
+// submit again to be reviewed for a higher level.
+func (s *KYCService) Submit(userID uuid.UUID) (*models.Profile, error) {
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Status == models.StatusPending {
+		return nil, fmt.Errorf("%w: already under review", ErrInvalidTransition)
+	}
+	if !hasDocument(profile.Documents, models.IdentityDocuments...) {
+		return nil, fmt.Errorf("%w: upload a passport, national ID or driver's license", ErrMissingDocuments)
+	}
+
+	now := time.Now()
+	profile.Status = models.StatusPending
+	profile.SubmittedAt = &now
+	profile.RejectionReason = ""
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "submitted_at", "rejection_reason", "updated_at"}),
+	}).Omit("Documents").Create(profile).Error
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// ListProfiles returns profiles in status (all if empty), oldest submission
+// first so reviewers work through the queue in order.
+func (s *KYCService) ListProfiles(status string, limit, offset int) ([]models.Profile, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	query := s.db.Order("submitted_at, user_id").Limit(limit).Offset(offset)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var profiles []models.Profile
+	err := query.Find(&profiles).Error
+	return profiles, err
+}
+
+// Approve verifies a pending profile at level. Level 2 also needs proof of
+// address on file.
+func (s *KYCService) Approve(userID, reviewerID uuid.UUID, level int) (*models.Profile, error) {
+	if level != models.LevelIdentity && level != models.LevelAddress {
+		return nil, fmt.Errorf("%w: level must be %d or %d", ErrInvalidTransition, models.LevelIdentity, models.LevelAddress)
+	}
+
+	return s.review(userID, reviewerID, func(profile *models.Profile) error {
+		if level == models.LevelAddress && !hasDocument(profile.Documents, models.DocumentProofOfAddress) {
+			return fmt.Errorf("%w: level %d needs proof of address", ErrMissingDocuments, level)
+		}
+		profile.Status = models.StatusVerified
+		profile.Level = level
+		profile.RejectionReason = ""
+		return nil
+	})
+}
+
+// Reject turns down a pending profile. Users who were already verified keep
+// the level they had; only the request for more is refused.
+func (s *KYCService) Reject(userID, reviewerID uuid.UUID, reason string) (*models.Profile, error) {
+	return s.review(userID, reviewerID, func(profile *models.Profile) error {
+		profile.Status = models.StatusRejected
+		if profile.Level > models.LevelNone {
+			profile.Status = models.StatusVerified
+		}
+		profile.RejectionReason = reason
+		return nil
+	})
+}
+
+func (s *KYCService) review(userID, reviewerID uuid.UUID, decide func(profile *models.Profile) error) (*models.Profile, error) {
+	if userID == reviewerID {
+		return nil, fmt.Errorf("%w: reviewers cannot review themselves", ErrInvalidTransition)
+	}
+
+	var profile models.Profile
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Documents").
+			First(&profile, "user_id = ?", userID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && profile.Status != models.StatusPending) {
+			return fmt.Errorf("%w: profile is not pending review", ErrInvalidTransition)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := decide(&profile); err != nil {
+			return err
+		}
+		now := time.Now()
+		profile.ReviewedAt = &now
+		profile.ReviewerID = &reviewerID
+		return tx.Model(&profile).Select("status", "level", "rejection_reason", "reviewed_at", "reviewer_id", "updated_at").
+			Updates(&profile).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func hasDocument(docs []models.Document, types ...models.DocumentType) bool {
+	for _, doc := range docs {
+		if containsDocumentType(types, doc.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDocumentType(types []models.DocumentType, t models.DocumentType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
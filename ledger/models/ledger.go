@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/money"
+)
+
+type AccountKind string
+
+const (
+	// WalletAccount holds the funds a user sees as their wallet balance.
+	WalletAccount AccountKind = "wallet"
+	// ClearingAccount is the counterpart for money entering or leaving the system.
+	ClearingAccount AccountKind = "clearing"
+	// FeeAccount collects fees charged on transactions.
+	FeeAccount AccountKind = "fee"
+	// FXAccount is the per-currency position the platform takes when users
+	// convert between their wallets.
+	FXAccount AccountKind = "fx"
+)
+
+type LedgerAccount struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	Code      string      `json:"code" gorm:"uniqueIndex;not null"`
+	Kind      AccountKind `json:"kind" gorm:"type:varchar(20);not null"`
+	Currency  string      `json:"currency" gorm:"type:varchar(3);not null;default:'USD'"`
+	UserID    *uuid.UUID  `json:"user_id,omitempty" gorm:"type:uuid;index"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// JournalEntry groups postings that must net to zero in each currency.
+type JournalEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Reference     string    `json:"reference" gorm:"index;not null"` // e.g. deposit, webhook:<event_id>
+	Description   string    `json:"description"`
+	TransactionID *uint     `json:"transaction_id,omitempty" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	Postings []Posting `json:"postings,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
+
+// Posting is a signed movement on a single account: positive amounts add to
+// the account balance, negative amounts take from it.
+type Posting struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	JournalEntryID uint         `json:"journal_entry_id" gorm:"index;not null"`
+	AccountID      uint         `json:"account_id" gorm:"index;not null"`
+	Amount         money.Amount `json:"amount" gorm:"not null"`
+	CreatedAt      time.Time    `json:"created_at"`
+
+	Account LedgerAccount `json:"account" gorm:"foreignKey:AccountID;references:ID"`
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/ledger/models"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEmptyEntry      = errors.New("journal entry needs at least two postings")
+	ErrUnbalancedEntry = errors.New("journal entry postings do not net to zero")
+)
+
+// Line is one side of a journal entry before it is written.
+type Line struct {
+	AccountCode string
+	Kind        models.AccountKind
+	Currency    string
+	UserID      *uuid.UUID
+	Amount      money.Amount
+}
+
+type LedgerService struct {
+	db *gorm.DB
+}
+
+func NewLedgerService(db *gorm.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+func WalletAccountCode(userID uuid.UUID, currency string) string {
+	return fmt.Sprintf("wallet:%s:%s", userID, currency)
+}
+
+func ClearingAccountCode(currency string) string {
+	return fmt.Sprintf("system:clearing:%s", currency)
+}
+
+func FeeAccountCode(currency string) string {
+	return fmt.Sprintf("system:fees:%s", currency)
+}
+
+func FXAccountCode(currency string) string {
+	return fmt.Sprintf("system:fx:%s", currency)
+}
+
+// WalletLine moves amount in or out of a user's wallet account.
+func WalletLine(userID uuid.UUID, currency string, amount money.Amount) Line {
+	id := userID
+	return Line{AccountCode: WalletAccountCode(userID, currency), Kind: models.WalletAccount, Currency: currency, UserID: &id, Amount: amount}
+}
+
+func ClearingLine(currency string, amount money.Amount) Line {
+	return Line{AccountCode: ClearingAccountCode(currency), Kind: models.ClearingAccount, Currency: currency, Amount: amount}
+}
+
+func FeeLine(currency string, amount money.Amount) Line {
+	return Line{AccountCode: FeeAccountCode(currency), Kind: models.FeeAccount, Currency: currency, Amount: amount}
+}
+
+func FXLine(currency string, amount money.Amount) Line {
+	return Line{AccountCode: FXAccountCode(currency), Kind: models.FXAccount, Currency: currency, Amount: amount}
+}
+
+// Post writes a balanced journal entry using tx, so it commits or rolls back
+// together with the balance change it describes.
+func (s *LedgerService) Post(tx *gorm.DB, reference, description string, transactionID *uint, lines ...Line) (*models.JournalEntry, error) {
+	if len(lines) < 2 {
+		return nil, ErrEmptyEntry
+	}
+
+	// Money never changes currency inside an entry, so each currency has to
+	// balance on its own.
+	sums := map[string]money.Amount{}
+	for _, l := range lines {
+		sums[l.Currency] += l.Amount
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return nil, ErrUnbalancedEntry
+		}
+	}
+
+	entry := models.JournalEntry{
+		Reference:     reference,
+		Description:   description,
+		TransactionID: transactionID,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to create journal entry: %v", err)
+	}
+
+	for _, l := range lines {
+		account, err := s.account(tx, l)
+		if err != nil {
+			return nil, err
+		}
+		posting := models.Posting{
+			JournalEntryID: entry.ID,
+			AccountID:      account.ID,
+			Amount:         l.Amount,
+		}
+		if err := tx.Create(&posting).Error; err != nil {
+			return nil, fmt.Errorf("failed to create posting: %v", err)
+		}
+		posting.Account = *account
+		entry.Postings = append(entry.Postings, posting)
+	}
+
+	return &entry, nil
+}
+
+// Reverse posts the opposite of every entry already booked against a
+// transaction, so the transaction no longer moves any money. The postings
+// of the returned entry say what changed on each account.
+func (s *LedgerService) Reverse(tx *gorm.DB, transactionID uint, reference, description string) (*models.JournalEntry, error) {
+	var entries []models.JournalEntry
+	err := tx.Preload("Postings.Account").Where("transaction_id = ?", transactionID).Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load journal entries: %v", err)
+	}
+
+	// Net each account first so a reversal of a reversal cancels out.
+	net := map[string]Line{}
+	var order []string
+	for _, entry := range entries {
+		for _, p := range entry.Postings {
+			l, ok := net[p.Account.Code]
+			if !ok {
+				l = Line{AccountCode: p.Account.Code, Kind: p.Account.Kind, Currency: p.Account.Currency, UserID: p.Account.UserID}
+				order = append(order, p.Account.Code)
+			}
+			l.Amount -= p.Amount
+			net[p.Account.Code] = l
+		}
+	}
+
+	var lines []Line
+	for _, code := range order {
+		if net[code].Amount != 0 {
+			lines = append(lines, net[code])
+		}
+	}
+	return s.Post(tx, reference, description, &transactionID, lines...)
+}
+
+// AccountBalance derives a balance from the postings on an account.
+func (s *LedgerService) AccountBalance(tx *gorm.DB, code string) (money.Amount, error) {
+	var balance money.Amount
+	err := tx.Raw(`
+		SELECT COALESCE(SUM(p.amount), 0)
+		FROM postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.code = ?`, code).Scan(&balance).Error
+	return balance, err
+}
+
+// WalletBalance derives a user's wallet balance from their postings.
+func (s *LedgerService) WalletBalance(userID uuid.UUID, currency string) (money.Amount, error) {
+	return s.AccountBalance(s.db, WalletAccountCode(userID, currency))
+}
+
+// GetWalletPostings lists the postings on a user's wallet accounts, newest
+// first. An empty currency includes every currency.
+func (s *LedgerService) GetWalletPostings(userID uuid.UUID, currency string, limit int) ([]models.Posting, error) {
+	var postings []models.Posting
+	if limit == 0 {
+		limit = 50
+	}
+
+	query := s.db.
+		Joins("Account").
+		Where("\"Account\".user_id = ? AND \"Account\".kind = ?", userID, models.WalletAccount)
+	if currency != "" {
+		query = query.Where("\"Account\".currency = ?", currency)
+	}
+
+	err := query.
+		Order("postings.created_at desc").
+		Limit(limit).
+		Find(&postings).Error
+	return postings, err
+}
+
+func (s *LedgerService) account(tx *gorm.DB, l Line) (*models.LedgerAccount, error) {
+	account := models.LedgerAccount{
+		Code:     l.AccountCode,
+		Kind:     l.Kind,
+		Currency: l.Currency,
+		UserID:   l.UserID,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create ledger account: %v", err)
+	}
+	if err := tx.Where("code = ?", l.AccountCode).First(&account).Error; err != nil {
+		return nil, fmt.Errorf("failed to load ledger account: %v", err)
+	}
+	return &account, nil
+}
@@ -0,0 +1,236 @@
+// Package lifecycle runs the process: it starts servers and background
+// workers, tracks one-off background tasks, and on SIGINT or SIGTERM stops
+// everything in order so nothing is cut off mid-write.
+//
+// Shutdown goes:
+//  1. report not ready, and wait DrainDelay for load balancers to notice;
+//  2. stop servers, letting in-flight requests finish;
+//  3. cancel background tasks and wait for them;
+//  4. stop workers, newest first, waiting for each to return;
+//  5. run closers, newest first.
+//
+// Every step shares the ShutdownTimeout deadline; anything still running
+// when it passes is abandoned.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Config says how long shutdown may take.
+type Config struct {
+	// ShutdownTimeout bounds the whole shutdown.
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long to keep serving after reporting not ready,
+	// so load balancers stop sending traffic before the server stops.
+	DrainDelay time.Duration
+}
+
+var DefaultConfig = Config{
+	ShutdownTimeout: 30 * time.Second,
+}
+
+type server struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+type worker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Manager owns everything that has to be stopped before the process exits.
+type Manager struct {
+	config   Config
+	ready    atomic.Bool
+	stopping atomic.Bool
+
+	mu      sync.Mutex
+	servers []server
+	workers []worker
+	closers []closer
+	failed  chan error
+
+	tasks       sync.WaitGroup
+	tasksCtx    context.Context
+	cancelTasks context.CancelFunc
+}
+
+func NewManager(config Config) *Manager {
+	tasksCtx, cancelTasks := context.WithCancel(context.Background())
+	return &Manager{
+		config:      config,
+		failed:      make(chan error, 1),
+		tasksCtx:    tasksCtx,
+		cancelTasks: cancelTasks,
+	}
+}
+
+// Ready reports whether the process is serving and not shutting down.
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// Stopped lists workers that have returned without being asked to, which
+// means whatever they do is no longer happening.
+func (m *Manager) Stopped() []string {
+	if m.stopping.Load() {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stopped []string
+	for _, w := range m.workers {
+		select {
+		case <-w.done:
+			stopped = append(stopped, w.name)
+		default:
+		}
+	}
+	return stopped
+}
+
+// Serve runs a server until shutdown. start blocks while serving; if it
+// fails for any reason other than being stopped, the process shuts down.
+func (m *Manager) Serve(name string, start func() error, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	m.servers = append(m.servers, server{name: name, stop: stop})
+	m.mu.Unlock()
+
+	go func() {
+		if err := start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case m.failed <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// Start runs a long-lived worker. run must return soon after ctx is done;
+// anything it needs to flush on the way out it does before returning.
+func (m *Manager) Start(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := worker{name: name, cancel: cancel, done: make(chan struct{})}
+
+	m.mu.Lock()
+	m.workers = append(m.workers, w)
+	m.mu.Unlock()
+
+	go func() {
+		defer close(w.done)
+		run(ctx)
+	}()
+}
+
+// Go runs a one-off task in the background. Shutdown cancels ctx once the
+// servers have stopped and waits for the task to return.
+func (m *Manager) Go(name string, task func(ctx context.Context)) {
+	m.tasks.Add(1)
+	go func() {
+		defer m.tasks.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("⚠️  Background task %s panicked: %v", name, r)
+			}
+		}()
+		task(m.tasksCtx)
+	}()
+}
+
+// OnClose registers cleanup to run once everything else has stopped, such
+// as closing database connections.
+func (m *Manager) OnClose(name string, close func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Wait reports ready and blocks until the process is asked to stop or a
+// server fails, then shuts down.
+func (m *Manager) Wait() {
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m.ready.Store(true)
+	select {
+	case <-signals.Done():
+		log.Println("🛑 Shutting down")
+	case err := <-m.failed:
+		log.Printf("❌ Server failed, shutting down: %v", err)
+	}
+	// A second signal kills the process the usual way.
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.ShutdownTimeout)
+	defer cancel()
+	m.Shutdown(ctx)
+}
+
+// Shutdown stops everything in order, giving up on whatever is still
+// running when ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) {
+	m.stopping.Store(true)
+	m.ready.Store(false)
+	if m.config.DrainDelay > 0 {
+		select {
+		case <-time.After(m.config.DrainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	m.mu.Lock()
+	servers, workers, closers := m.servers, m.workers, m.closers
+	m.mu.Unlock()
+
+	for _, s := range servers {
+		if err := s.stop(ctx); err != nil {
+			log.Printf("⚠️  Failed to stop %s cleanly: %v", s.name, err)
+		}
+	}
+
+	m.cancelTasks()
+	tasksDone := make(chan struct{})
+	go func() {
+		m.tasks.Wait()
+		close(tasksDone)
+	}()
+	select {
+	case <-tasksDone:
+	case <-ctx.Done():
+		log.Println("⚠️  Gave up waiting for background tasks")
+	}
+
+	for i := len(workers) - 1; i >= 0; i-- {
+		w := workers[i]
+		w.cancel()
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			log.Printf("⚠️  Gave up waiting for %s to stop", w.name)
+		}
+	}
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].close(); err != nil {
+			log.Printf("⚠️  Failed to close %s: %v", closers[i].name, err)
+		}
+	}
+	log.Println("👋 Shutdown complete")
+}
@@ -0,0 +1,39 @@
+package money
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// supportedCurrencies are the ISO 4217 codes wallets can be opened in. Amount
+// assumes two minor-unit digits, so only currencies with cents belong here.
+var supportedCurrencies = map[string]bool{
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"ETB": true,
+	"KES": true,
+}
+
+// NormalizeCurrency upper-cases code and checks it is supported. An empty
+// code means DefaultCurrency.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if !supportedCurrencies[code] {
+		return "", ErrUnsupportedCurrency
+	}
+	return code, nil
+}
+
+func SupportedCurrencies() []string {
+	codes := make([]string, 0, len(supportedCurrencies))
+	for code := range supportedCurrencies {
+		codes = append(codes, code)
+	}
+	return codes
+}
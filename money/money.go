@@ -0,0 +1,232 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is an exact money value stored as integer minor units (cents).
+// It is written to Postgres as numeric(20,2) and to JSON as a decimal number,
+// so no value ever passes through a float.
+type Amount int64
+
+// Money pairs an amount with the currency it is denominated in.
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+const (
+	DefaultCurrency = "USD"
+
+	// minorUnits is the number of minor units in one major unit.
+	minorUnits = 100
+	decimals   = 2
+)
+
+var ErrInvalidAmount = errors.New("invalid money amount")
+
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// Parse reads a decimal string such as "12.34" or "-0.5". Digits past the
+// second decimal place are only accepted when they are zeros.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > decimals {
+		if strings.Trim(frac[decimals:], "0") != "" {
+			return 0, fmt.Errorf("%w: more than %d decimal places in %q", ErrInvalidAmount, decimals, s)
+		}
+		frac = frac[:decimals]
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if units > (math.MaxInt64-cents)/minorUnits {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+
+	minor := units*minorUnits + cents
+	if negative {
+		minor = -minor
+	}
+	return Amount(minor), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+func (a Amount) String() string {
+	minor := int64(a)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/minorUnits, minor%minorUnits)
+}
+
+// Percent returns percent% of a, rounded half away from zero to the nearest
+// minor unit. percent is read as the shortest decimal that prints the same,
+// so 2.5 means exactly 2.5 and not the float closest to it.
+func (a Amount) Percent(percent float64) Amount {
+	rate, ok := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	if !ok {
+		return 0
+	}
+	rate.Quo(rate, big.NewRat(100, 1))
+	return a.MulRat(rate)
+}
+
+// MulRat multiplies a by an exact rational factor, rounding half away from
+// zero to the nearest minor unit.
+func (a Amount) MulRat(factor *big.Rat) Amount {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), factor)
+	return Amount(roundRat(product))
+}
+
+func roundRat(r *big.Rat) int64 {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	// (2*num + den) / (2*den) rounds half up on the absolute value.
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, den)
+	q := new(big.Int).Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+
+	if negative {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and quoted decimal strings and
+// parses the literal text directly, without going through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported", ErrInvalidAmount)
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * minorUnits)
+		return nil
+	case float64:
+		*a = Amount(math.Round(v * minorUnits))
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// GormDataType keeps every money column exact in Postgres.
+func (Amount) GormDataType() string {
+	return "numeric(20,2)"
+}
@@ -0,0 +1,53 @@
+// Package outbox publishes events reliably. An event is written as a
+// Message in the same database transaction as the change it describes, so
+// it exists exactly when the change does; a Relay then hands pending
+// messages to a Publisher, retrying with backoff until it succeeds.
+//
+// Delivery is at least once: a message can be published again if the
+// process dies between publishing and recording it, so consumers should
+// dedupe on the message id.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Message is one event waiting to be, or already, published.
+type Message struct {
+	ID    uint64 `json:"id" gorm:"primaryKey"`
+	Topic string `json:"topic" gorm:"size:100;not null"`
+	// Key groups messages about the same thing, such as a user id.
+	// Messages with the same key are published in the order they were
+	// written; an empty key means no order is needed.
+	Key     string         `json:"key" gorm:"size:100;index:idx_outbox_pending_key,where:published_at IS NULL"`
+	Payload datatypes.JSON `json:"payload" gorm:"type:jsonb;not null"`
+
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_pending,where:published_at IS NULL"`
+	PublishedAt   *time.Time `json:"published_at,omitempty" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Enqueue records an event inside tx. It is published only if tx commits.
+func Enqueue(tx *gorm.DB, topic, key string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", topic, err)
+	}
+	return tx.Create(&Message{
+		Topic:         topic,
+		Key:           key,
+		Payload:       data,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,42 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Publisher hands a message to whatever carries events to consumers. It
+// must return an error unless the message was accepted.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// RedisStreamPublisher appends each message to the Redis stream
+// <prefix><topic>. Streams are trimmed to roughly maxLen entries; zero
+// keeps everything.
+type RedisStreamPublisher struct {
+	client *redis.Client
+	prefix string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(client *redis.Client, prefix string, maxLen int64) *RedisStreamPublisher {
+	return &RedisStreamPublisher{client: client, prefix: prefix, maxLen: maxLen}
+}
+
+func (p *RedisStreamPublisher) Publish(ctx context.Context, msg Message) error {
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.prefix + msg.Topic,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: map[string]interface{}{
+			"id":         strconv.FormatUint(msg.ID, 10),
+			"key":        msg.Key,
+			"payload":    string(msg.Payload),
+			"created_at": msg.CreatedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
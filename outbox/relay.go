@@ -0,0 +1,245 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RelayConfig tunes how a Relay publishes and retries.
+type RelayConfig struct {
+	// BatchSize is how many messages are published per round.
+	BatchSize int
+	// PollInterval is how long to wait before looking again when nothing
+	// was due.
+	PollInterval time.Duration
+	// MinBackoff and MaxBackoff bound the wait before retrying a message
+	// that failed to publish; it doubles with every attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long published messages are kept before they are
+	// deleted.
+	Retention time.Duration
+	// DrainTimeout bounds how long Run keeps publishing after it is told
+	// to stop.
+	DrainTimeout time.Duration
+}
+
+var DefaultRelayConfig = RelayConfig{
+	BatchSize:    100,
+	PollInterval: time.Second,
+	MinBackoff:   time.Second,
+	MaxBackoff:   5 * time.Minute,
+	Retention:    7 * 24 * time.Hour,
+	DrainTimeout: 10 * time.Second,
+}
+
+// batchTimeout bounds one round of publishing, so a hung publisher cannot
+// hold row locks forever.
+const batchTimeout = 30 * time.Second
+
+// Relay moves pending messages to a Publisher. Several instances can run
+// at once: each round locks the rows it takes and skips rows another
+// instance holds. Messages with the same key are published in the order
+// they were written, even across instances: a round leaves a message alone
+// while an earlier one with its key is due but held elsewhere. The one
+// exception is that a message waiting to be retried does not hold back the
+// ones after it.
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	config    RelayConfig
+	// lastRound is when Run last finished a round, in Unix nanoseconds.
+	lastRound atomic.Int64
+}
+
+func NewRelay(db *gorm.DB, publisher Publisher, config RelayConfig) *Relay {
+	return &Relay{db: db, publisher: publisher, config: config}
+}
+
+// Run publishes messages as they become due until ctx is done, then
+// drains what is still due for up to DrainTimeout. A round that has
+// started is allowed to finish, so nothing it published goes unrecorded.
+func (r *Relay) Run(ctx context.Context) {
+	poll := time.NewTicker(r.config.PollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		batchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), batchTimeout)
+		more, err := r.publishBatch(batchCtx)
+		cancel()
+		if err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+		} else {
+			r.lastRound.Store(time.Now().UnixNano())
+		}
+		if err == nil && more && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), r.config.DrainTimeout)
+			defer cancel()
+			if err := r.Drain(drainCtx); err != nil {
+				log.Printf("Outbox drain stopped early: %v", err)
+			}
+			return
+		case <-poll.C:
+		case <-prune.C:
+			if err := r.Prune(ctx); err != nil {
+				log.Printf("Failed to prune outbox: %v", err)
+			}
+		}
+	}
+}
+
+// Drain publishes everything that is due now, for a clean shutdown. It
+// stops early when ctx is done or when the only messages left are waiting
+// out a retry backoff or queued behind messages another instance holds.
+func (r *Relay) Drain(ctx context.Context) error {
+	for {
+		more, err := r.publishBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// LastRound is when Run last finished a round without error; zero if it
+// never has.
+func (r *Relay) LastRound() time.Time {
+	if n := r.lastRound.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// Lag is how long the oldest unpublished message has been waiting; zero
+// when everything is published.
+func (r *Relay) Lag(ctx context.Context) (time.Duration, error) {
+	var oldest *time.Time
+	err := r.db.WithContext(ctx).Model(&Message{}).
+		Where("published_at IS NULL").
+		Select("MIN(created_at)").
+		Scan(&oldest).Error
+	if err != nil || oldest == nil {
+		return 0, err
+	}
+	return time.Since(*oldest), nil
+}
+
+// Prune deletes messages published more than Retention ago.
+func (r *Relay) Prune(ctx context.Context) error {
+	cutoff := time.Now().Add(-r.config.Retention)
+	return r.db.WithContext(ctx).Where("published_at < ?", cutoff).Delete(&Message{}).Error
+}
+
+// publishBatch publishes one batch of due messages, whether or not they
+// are accepted, and reports whether more may be due: the batch was full and
+// it got somewhere. A full batch that was all held back waits for the
+// instance holding the earlier messages instead of selecting it again.
+func (r *Relay) publishBatch(ctx context.Context) (bool, error) {
+	var more bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").
+			Limit(r.config.BatchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+		full := len(messages) == r.config.BatchSize
+		if messages, err = holdBack(tx, messages, now); err != nil {
+			return err
+		}
+		more = full && len(messages) > 0
+
+		for _, msg := range messages {
+			attempts := msg.Attempts + 1
+			updates := map[string]interface{}{"attempts": attempts, "last_error": ""}
+			if err := r.publisher.Publish(ctx, msg); err != nil {
+				updates["last_error"] = err.Error()
+				updates["next_attempt_at"] = time.Now().Add(r.backoff(attempts))
+				log.Printf("Failed to publish outbox message %d (%s), attempt %d: %v", msg.ID, msg.Topic, attempts, err)
+			} else {
+				updates["published_at"] = time.Now()
+			}
+			if err := tx.Model(&Message{}).Where("id = ?", msg.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return more, err
+}
+
+// holdBack drops the messages that would overtake an earlier due message
+// with the same key that this round did not take, because another instance
+// holds it or it fell outside the batch. messages must be in id order.
+func holdBack(tx *gorm.DB, messages []Message, now time.Time) ([]Message, error) {
+	var ids []uint64
+	var keys []string
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+		if msg.Key != "" {
+			keys = append(keys, msg.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return messages, nil
+	}
+
+	var earlier []Message
+	err := tx.Select("id", "key").
+		Where("published_at IS NULL AND next_attempt_at <= ?", now).
+		Where("key IN ? AND id < ? AND id NOT IN ?", keys, ids[len(ids)-1], ids).
+		Find(&earlier).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(earlier) == 0 {
+		return messages, nil
+	}
+
+	// first is the oldest message of each key that someone else holds.
+	first := make(map[string]uint64, len(earlier))
+	for _, msg := range earlier {
+		if id, ok := first[msg.Key]; !ok || msg.ID < id {
+			first[msg.Key] = msg.ID
+		}
+	}
+	kept := messages[:0]
+	for _, msg := range messages {
+		if id, ok := first[msg.Key]; ok && msg.ID > id {
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept, nil
+}
+
+// backoff is how long to wait before the next attempt, after attempts
+// failed ones.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.config.MinBackoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.config.MaxBackoff {
+		delay = r.config.MaxBackoff
+	}
+	return delay
+}
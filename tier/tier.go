@@ -0,0 +1,56 @@
+// Package tier defines the account tiers shared by auth, which stores a
+// user's tier, and wallet, which prices and limits by it.
+package tier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Tier string
+
+const (
+	Basic      Tier = "basic"
+	Premium    Tier = "premium"
+	Enterprise Tier = "enterprise"
+)
+
+// All lists the tiers from lowest to highest.
+var All = []Tier{Basic, Premium, Enterprise}
+
+var ErrInvalidTier = errors.New("invalid tier")
+
+// Parse reads a tier name case-insensitively and rejects unknown tiers.
+func Parse(s string) (Tier, error) {
+	t := Tier(strings.ToLower(strings.TrimSpace(s)))
+	if !t.Valid() {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTier, s)
+	}
+	return t, nil
+}
+
+// Normalize maps a stored tier ("Premium", "basic", "") to a known tier,
+// treating anything unknown as basic.
+func Normalize(s string) Tier {
+	t, err := Parse(s)
+	if err != nil {
+		return Basic
+	}
+	return t
+}
+
+func (t Tier) Valid() bool {
+	return t.Rank() >= 0
+}
+
+// Rank orders tiers so upgrades can be told from downgrades. Unknown tiers
+// rank -1.
+func (t Tier) Rank() int {
+	for i, known := range All {
+		if t == known {
+			return i
+		}
+	}
+	return -1
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/go-playground/validator/v10"
 
 	user_models "github.com/nazrawigedion123/wallet-backend/auth/models"
+	kyc_models "github.com/nazrawigedion123/wallet-backend/kyc/models"
+	ledger_models "github.com/nazrawigedion123/wallet-backend/ledger/models"
+	"github.com/nazrawigedion123/wallet-backend/outbox"
 	wallet_models "github.com/nazrawigedion123/wallet-backend/wallet/models"
 	webhook_models "github.com/nazrawigedion123/wallet-backend/webhook/models"
 	"github.com/redis/go-redis/v9"
@@ -61,15 +64,49 @@ func InitDB() error {
 	if err != nil {
 		return err
 	}
+	if err := migrateMoneyColumns(DB); err != nil {
+		return err
+	}
+	if err := migrateWalletCurrencies(DB); err != nil {
+		return err
+	}
+	if err := migrateEmailVerification(DB); err != nil {
+		return err
+	}
+	if err := migrateUserTiers(DB); err != nil {
+		return err
+	}
+	if err := migrateTierLimitScope(DB); err != nil {
+		return err
+	}
+
 	// Auto-migrate the Transaction model
 	err = DB.AutoMigrate(&user_models.User{},
 		&wallet_models.Transaction{},
 		&wallet_models.WalletBalance{},
 		&webhook_models.WebhookEvent{},
+		&ledger_models.LedgerAccount{},
+		&ledger_models.JournalEntry{},
+		&ledger_models.Posting{},
+		&wallet_models.FeeConfig{},
+		&wallet_models.FeeConfigAudit{},
+		&wallet_models.TierLimit{},
+		&wallet_models.KYCRequirement{},
+		&user_models.RecoveryCode{},
+		&user_models.AccountToken{},
+		&user_models.TierChange{},
+		&user_models.APIKey{},
+		&user_models.OIDCIdentity{},
+		&kyc_models.Profile{},
+		&kyc_models.Document{},
+		&outbox.Message{},
 	)
 	if err != nil {
 		return err
 	}
+	if err := migrateLedgerCurrencies(DB); err != nil {
+		return err
+	}
 
 	log.Println("Auto migration complete")
 
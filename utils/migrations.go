@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists every column that used to hold money as a float.
+var moneyColumns = []struct {
+	Table  string
+	Column string
+}{
+	{"transactions", "amount"},
+	{"transactions", "fee"},
+	{"transactions", "net_amount"},
+	{"wallet_balances", "balance"},
+	{"webhook_events", "amount"},
+	{"postings", "amount"},
+}
+
+// migrateMoneyColumns converts float money columns to numeric(20,2) before
+// AutoMigrate runs. Values are rounded to the cent on the way so existing
+// balances come out as exact decimals instead of their float approximations.
+func migrateMoneyColumns(db *gorm.DB) error {
+	for _, c := range moneyColumns {
+		var dataType string
+		err := db.Raw(`
+			SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+			c.Table, c.Column).Scan(&dataType).Error
+		if err != nil {
+			return err
+		}
+		if dataType != "double precision" && dataType != "real" {
+			continue
+		}
+
+		sql := fmt.Sprintf(`ALTER TABLE %q ALTER COLUMN %q TYPE numeric(20,2) USING round(%q::numeric, 2)`,
+			c.Table, c.Column, c.Column)
+		if err := db.Exec(sql).Error; err != nil {
+			return fmt.Errorf("failed to convert %s.%s to numeric: %v", c.Table, c.Column, err)
+		}
+		log.Printf("Converted %s.%s to numeric", c.Table, c.Column)
+	}
+	return nil
+}
+
+// migrateWalletCurrencies moves wallet_balances from one row per user to one
+// row per (user, currency). Existing balances become USD wallets.
+func migrateWalletCurrencies(db *gorm.DB) error {
+	if !db.Migrator().HasTable("wallet_balances") || db.Migrator().HasColumn("wallet_balances", "currency") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`ALTER TABLE wallet_balances ADD COLUMN currency varchar(3) NOT NULL DEFAULT 'USD'`,
+			`ALTER TABLE wallet_balances DROP CONSTRAINT IF EXISTS wallet_balances_pkey`,
+			`ALTER TABLE wallet_balances ADD PRIMARY KEY (user_id, currency)`,
+		}
+		for _, sql := range statements {
+			if err := tx.Exec(sql).Error; err != nil {
+				return fmt.Errorf("failed to migrate wallet currencies: %v", err)
+			}
+		}
+		log.Println("Migrated wallet_balances to per-currency wallets")
+		return nil
+	})
+}
+
+// migrateLedgerCurrencies renames ledger accounts created before wallets had
+// a currency so they match the currency-suffixed codes used now. It runs
+// after AutoMigrate has added ledger_accounts.currency.
+func migrateLedgerCurrencies(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE ledger_accounts
+		SET code = code || ':' || currency
+		WHERE code IN ('system:clearing', 'system:fees')
+			OR (kind = 'wallet' AND code = 'wallet:' || user_id::text)`).Error
+}
+
+// migrateEmailVerification adds users.email_verified_at before AutoMigrate
+// and marks everyone who signed up before verification existed as verified.
+func migrateEmailVerification(db *gorm.DB) error {
+	if !db.Migrator().HasTable("users") || db.Migrator().HasColumn("users", "email_verified_at") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`ALTER TABLE users ADD COLUMN email_verified_at timestamptz`).Error; err != nil {
+			return fmt.Errorf("failed to add users.email_verified_at: %v", err)
+		}
+		result := tx.Exec(`UPDATE users SET email_verified_at = now()`)
+		if result.Error != nil {
+			return result.Error
+		}
+		log.Printf("Marked %d existing users as verified", result.RowsAffected)
+		return nil
+	})
+}
+
+// migrateUserTiers rewrites stored tiers to their canonical lowercase names
+// ("Premium" becomes "premium") before AutoMigrate makes the column NOT NULL.
+// Anything unrecognised becomes basic.
+func migrateUserTiers(db *gorm.DB) error {
+	if !db.Migrator().HasTable("users") {
+		return nil
+	}
+
+	result := db.Exec(`
+		UPDATE users SET tier = CASE
+			WHEN lower(trim(tier)) IN ('basic', 'premium', 'enterprise') THEN lower(trim(tier))
+			ELSE 'basic'
+		END
+		WHERE tier IS NULL OR tier NOT IN ('basic', 'premium', 'enterprise')`)
+	if result.Error != nil {
+		return fmt.Errorf("failed to normalize user tiers: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Normalized the tier of %d users", result.RowsAffected)
+	}
+	return nil
+}
+
+// migrateTierLimitScope drops the old (tier, type, currency) unique index on
+// tier_limits before AutoMigrate adds kyc_level, so one tier can have a row
+// per verification level. Existing rows become the level 0 limits.
+func migrateTierLimitScope(db *gorm.DB) error {
+	if !db.Migrator().HasTable("tier_limits") || db.Migrator().HasColumn("tier_limits", "kyc_level") {
+		return nil
+	}
+
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_tier_limits_key`).Error; err != nil {
+		return fmt.Errorf("failed to drop idx_tier_limits_key: %v", err)
+	}
+	log.Println("Dropped idx_tier_limits_key ahead of per-level tier limits")
+	return nil
+}
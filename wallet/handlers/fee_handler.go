@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+	"github.com/nazrawigedion123/wallet-backend/wallet/services"
+)
+
+// FeeConfigRequest describes a new version of a fee rule. effective_from
+// defaults to now.
+type FeeConfigRequest struct {
+	TransactionType string              `json:"transaction_type" validate:"required"`
+	Tier            string              `json:"tier" validate:"required"`
+	FlatFee         money.Amount        `json:"flat_fee"`
+	BasePercent     float64             `json:"base_percent"`
+	Brackets        []models.FeeBracket `json:"brackets"`
+	Cap             *money.Amount       `json:"cap"`
+	Floor           money.Amount        `json:"floor"`
+	PeakWindows     []models.PeakWindow `json:"peak_windows"`
+	PeakSurcharge   float64             `json:"peak_surcharge"`
+	Timezone        string              `json:"timezone"`
+	EffectiveFrom   time.Time           `json:"effective_from"`
+}
+
+func (r FeeConfigRequest) toModel() models.FeeConfig {
+	return models.FeeConfig{
+		TransactionType: models.TransactionType(strings.ToLower(r.TransactionType)),
+		Tier:            models.UserTier(strings.ToLower(r.Tier)),
+		FlatFee:         r.FlatFee,
+		BasePercent:     r.BasePercent,
+		Brackets:        r.Brackets,
+		Cap:             r.Cap,
+		Floor:           r.Floor,
+		PeakWindows:     r.PeakWindows,
+		PeakSurcharge:   r.PeakSurcharge,
+		Timezone:        r.Timezone,
+		EffectiveFrom:   r.EffectiveFrom,
+	}
+}
+
+// FeePreviewRequest prices amount with either a stored rule (fee_config_id)
+// or an unsaved draft (config), as of at (default now).
+type FeePreviewRequest struct {
+	FeeConfigID uint              `json:"fee_config_id"`
+	Config      *FeeConfigRequest `json:"config"`
+	Amount      money.Amount      `json:"amount" validate:"required,gt=0"`
+	At          time.Time         `json:"at"`
+}
+
+// RetireFeeConfigRequest ends a rule at effective_to, default now.
+type RetireFeeConfigRequest struct {
+	EffectiveTo time.Time `json:"effective_to"`
+}
+
+func (h *WalletHandler) ListFeeConfigs(c echo.Context) error {
+	includeRetired, _ := strconv.ParseBool(c.QueryParam("include_retired"))
+
+	configs, err := h.FeeService.ListConfigs(c.QueryParam("transaction_type"), c.QueryParam("tier"), includeRetired)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch fee configs"})
+	}
+
+	return c.JSON(http.StatusOK, configs)
+}
+
+func (h *WalletHandler) GetFeeConfig(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid fee config id")
+	}
+
+	config, err := h.FeeService.GetConfig(uint(id))
+	if err != nil {
+		return feeError(err)
+	}
+
+	return c.JSON(http.StatusOK, config)
+}
+
+func (h *WalletHandler) CreateFeeConfig(c echo.Context) error {
+	actorID := c.Get("userID").(uuid.UUID)
+
+	var req FeeConfigRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	config, err := h.FeeService.CreateConfig(actorID, req.toModel())
+	if err != nil {
+		return feeError(err)
+	}
+
+	return c.JSON(http.StatusCreated, config)
+}
+
+func (h *WalletHandler) PreviewFee(c echo.Context) error {
+	var req FeePreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var config models.FeeConfig
+	switch {
+	case req.FeeConfigID != 0:
+		stored, err := h.FeeService.GetConfig(req.FeeConfigID)
+		if err != nil {
+			return feeError(err)
+		}
+		config = *stored
+	case req.Config != nil:
+		config = req.Config.toModel()
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "fee_config_id or config is required")
+	}
+
+	result, err := h.FeeService.Preview(config, req.Amount, req.At)
+	if err != nil {
+		return feeError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"amount":    req.Amount,
+		"fee":       result.Fee,
+		"breakdown": result.Breakdown,
+	})
+}
+
+func (h *WalletHandler) RetireFeeConfig(c echo.Context) error {
+	actorID := c.Get("userID").(uuid.UUID)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid fee config id")
+	}
+
+	var req RetireFeeConfigRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	config, err := h.FeeService.RetireConfig(actorID, uint(id), req.EffectiveTo)
+	if err != nil {
+		return feeError(err)
+	}
+
+	return c.JSON(http.StatusOK, config)
+}
+
+func (h *WalletHandler) GetFeeAudit(c echo.Context) error {
+	var feeConfigID uint64
+	if v := c.QueryParam("fee_config_id"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid fee_config_id")
+		}
+		feeConfigID = parsed
+	}
+
+	limit := 50
+	if l := c.QueryParam("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	audit, err := h.FeeService.GetAudit(uint(feeConfigID), limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch fee audit"})
+	}
+
+	return c.JSON(http.StatusOK, audit)
+}
+
+func feeError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrFeeConfigNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidFeeConfig):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFeeCoverageGap):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// FeeQuoteRequest asks what a deposit, withdrawal or transfer would cost.
+type FeeQuoteRequest struct {
+	Type     string       `json:"type" validate:"required"`
+	Amount   money.Amount `json:"amount" validate:"required,gt=0"`
+	Currency string       `json:"currency"` // defaults to USD
+}
+
+// QuoteFee prices a transaction for the caller's tier without running it.
+// The returned quote_token can be sent with the transaction to lock the fee.
+func (h *WalletHandler) QuoteFee(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+	userTier, ok := c.Get("userTier").(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user tier")
+	}
+
+	var req FeeQuoteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	quote, err := h.FeeService.Quote(userID, userTier, models.TransactionType(strings.ToLower(req.Type)), req.Amount, req.Currency)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
+
+// feeQuoteError maps a rejected quote token to its HTTP error, or returns
+// nil if err is not about the quote.
+func feeQuoteError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidFeeQuote):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrFeeQuoteExpired):
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	case errors.Is(err, services.ErrFeeQuoteUsed):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return nil
+	}
+}
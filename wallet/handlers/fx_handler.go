@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+type ConvertQuoteRequest struct {
+	FromCurrency string       `json:"from_currency" validate:"required"`
+	ToCurrency   string       `json:"to_currency" validate:"required"`
+	Amount       money.Amount `json:"amount" validate:"required,gt=0"`
+}
+
+// ConvertRequest either executes an earlier quote or, without quote_id,
+// quotes and converts in one step.
+type ConvertRequest struct {
+	QuoteID      string       `json:"quote_id"`
+	FromCurrency string       `json:"from_currency"`
+	ToCurrency   string       `json:"to_currency"`
+	Amount       money.Amount `json:"amount"`
+	// TwoFactorCode is needed for conversions over the step-up limit.
+	TwoFactorCode string `json:"two_factor_code"`
+}
+
+func (h *WalletHandler) ConvertQuote(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	var req ConvertQuoteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	quote, err := h.FXService.Quote(userID, req.FromCurrency, req.ToCurrency, req.Amount)
+	if err != nil {
+		return transactionError(err)
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
+
+func (h *WalletHandler) Convert(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	var req ConvertRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	var (
+		txns []models.Transaction
+		err  error
+	)
+	if req.QuoteID != "" {
+		txns, err = h.FXService.Execute(userID, req.QuoteID, req.TwoFactorCode)
+	} else {
+		if req.FromCurrency == "" || req.ToCurrency == "" || req.Amount <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "quote_id or from_currency, to_currency and amount are required")
+		}
+		txns, err = h.FXService.Convert(userID, req.FromCurrency, req.ToCurrency, req.Amount, req.TwoFactorCode)
+	}
+	if err != nil {
+		return transactionError(err)
+	}
+
+	return c.JSON(http.StatusOK, txns)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+	"github.com/nazrawigedion123/wallet-backend/wallet/services"
+)
+
+// GetLimits shows how much the caller can still deposit, withdraw and
+// transfer in each rolling window for a currency (default USD).
+func (h *WalletHandler) GetLimits(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+	userTier, ok := c.Get("userTier").(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user tier")
+	}
+	currency, err := money.NormalizeCurrency(c.QueryParam("currency"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	usage, err := h.LimitService.Usages(userID, userTier, currency)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch limits")
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
+
+func (h *WalletHandler) ListTierLimits(c echo.Context) error {
+	limits, err := h.LimitService.ListLimits()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch limits")
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+// SetTierLimit creates or replaces the limit for a tier, transaction type
+// and currency. Omitted caps are unlimited.
+func (h *WalletHandler) SetTierLimit(c echo.Context) error {
+	var req models.TierLimit
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	req.ID = 0
+
+	limit, err := h.LimitService.SetLimit(req)
+	if errors.Is(err, services.ErrInvalidTierLimit) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, limit)
+}
+
+func (h *WalletHandler) DeleteTierLimit(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit id")
+	}
+
+	err = h.LimitService.DeleteLimit(uint(id))
+	if errors.Is(err, services.ErrTierLimitNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListKYCRequirements shows the verification level each transaction type
+// needs.
+func (h *WalletHandler) ListKYCRequirements(c echo.Context) error {
+	requirements, err := h.LimitService.ListKYCRequirements()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not fetch verification requirements")
+	}
+
+	return c.JSON(http.StatusOK, requirements)
+}
+
+func (h *WalletHandler) SetKYCRequirement(c echo.Context) error {
+	var req models.KYCRequirement
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	requirement, err := h.LimitService.SetKYCRequirement(req)
+	if errors.Is(err, services.ErrInvalidKYCRule) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, requirement)
+}
+
+// limitError maps a broken transaction limit to a 422 that says which limit
+// was hit and when it resets, and a missing verification level to a 403
+// naming the level needed. It returns nil if err is about neither.
+func limitError(err error) error {
+	var required *services.KYCRequiredError
+	if errors.As(err, &required) {
+		return echo.NewHTTPError(http.StatusForbidden, echo.Map{
+			"error":          required.Error(),
+			"required_level": required.RequiredLevel,
+			"current_level":  required.CurrentLevel,
+		})
+	}
+
+	var exceeded *services.LimitExceededError
+	if !errors.As(err, &exceeded) {
+		return nil
+	}
+
+	body := echo.Map{
+		"error": exceeded.Error(),
+		"limit": exceeded.Limit,
+		"max":   exceeded.Max,
+	}
+	if exceeded.ResetsAt != nil {
+		body["resets_at"] = exceeded.ResetsAt
+	}
+	return echo.NewHTTPError(http.StatusUnprocessableEntity, body)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -17,7 +18,9 @@ func (h *WalletHandler) SimulateUsers(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Count must be greater than 0"})
 	}
 
-	go h.WalletService.GenerateUsers(opts) // run in background
+	h.Tasks.Go("user simulation", func(ctx context.Context) {
+		h.WalletService.GenerateUsers(ctx, opts)
+	})
 
 	return c.JSON(http.StatusAccepted, echo.Map{"message": "User simulation started"})
 }
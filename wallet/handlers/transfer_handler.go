@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/money"
+)
+
+// TransferRequest names the recipient by either recipient_id or
+// recipient_email.
+type TransferRequest struct {
+	RecipientID    string       `json:"recipient_id"`
+	RecipientEmail string       `json:"recipient_email"`
+	Amount         money.Amount `json:"amount" validate:"required,gt=0"`
+	Currency       string       `json:"currency"` // defaults to USD
+	QuoteToken     string       `json:"quote_token"`
+	// TwoFactorCode is needed for transfers over the step-up limit.
+	TwoFactorCode string `json:"two_factor_code"`
+}
+
+func (h *WalletHandler) Transfer(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+	userTier, ok := c.Get("userTier").(string)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user tier")
+	}
+
+	var req TransferRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	recipient := req.RecipientID
+	if recipient == "" {
+		recipient = req.RecipientEmail
+	}
+	if recipient == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "recipient_id or recipient_email is required")
+	}
+
+	txns, err := h.WalletService.Transfer(userID, userTier, recipient, req.Amount, req.Currency, req.QuoteToken, req.TwoFactorCode)
+	if err != nil {
+		return transactionError(err)
+	}
+
+	return c.JSON(http.StatusOK, txns)
+}
@@ -1,35 +1,65 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/interfaces"
 	"github.com/nazrawigedion123/wallet-backend/wallet/services"
 )
 
 type WalletHandler struct {
 	WalletService *services.WalletService
+	FXService     *services.FXService
+	FeeService    *services.FeeService
+	LimitService  *services.LimitService
+	// Tasks runs long jobs such as user simulation past the request.
+	Tasks interfaces.TaskRunner
 }
 
 type TransactionRequest struct {
-	Amount float64 `json:"amount" validate:"required,gt=0"`
+	Amount   money.Amount `json:"amount" validate:"required,gt=0"`
+	Currency string       `json:"currency"` // defaults to USD
+	// QuoteToken locks in the fee from an earlier POST /wallet/quote.
+	QuoteToken string `json:"quote_token"`
+	// TwoFactorCode is needed for withdrawals over the step-up limit.
+	TwoFactorCode string `json:"two_factor_code"`
 }
 
 func (h *WalletHandler) GetBalance(c echo.Context) error {
-	fmt.Println("Get balance handler")
 	userID := c.Get("userID").(uuid.UUID)
 
-	balance, err := h.WalletService.GetBalance(userID)
+	if currency := c.QueryParam("currency"); currency != "" {
+		currency, err := money.NormalizeCurrency(currency)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		balance, err := h.WalletService.GetBalance(userID, currency)
+		if errors.Is(err, services.ErrWalletNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "could not get balance")
+		}
+		return c.JSON(http.StatusOK, echo.Map{
+			"user_id":  userID,
+			"balances": []money.Money{balance},
+		})
+	}
+
+	balances, err := h.WalletService.GetBalances(userID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "could not get balance")
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user_id": userID,
-		"balance": balance,
+		"user_id":  userID,
+		"balances": balances,
 	})
 }
 
@@ -49,9 +79,9 @@ func (h *WalletHandler) Deposit(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	txn, err := h.WalletService.Deposit(userID, userTier, req.Amount)
+	txn, err := h.WalletService.Deposit(userID, userTier, req.Amount, req.Currency, req.QuoteToken)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return transactionError(err)
 	}
 
 	return c.JSON(http.StatusOK, txn)
@@ -66,7 +96,6 @@ func (h *WalletHandler) Withdraw(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid user tier")
 	}
 
-
 	var req TransactionRequest
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
@@ -75,18 +104,58 @@ func (h *WalletHandler) Withdraw(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	txn, err := h.WalletService.Withdraw(userID,userTier, req.Amount)
+	txn, err := h.WalletService.Withdraw(userID, userTier, req.Amount, req.Currency, req.QuoteToken, req.TwoFactorCode)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return transactionError(err)
 	}
 
 	return c.JSON(http.StatusOK, txn)
 }
+
+// transactionError maps an error from moving money to its HTTP error.
+// Quote and limit errors map as feeQuoteError and limitError say; mistakes
+// in the request are 400s and a missing wallet or recipient is a 404.
+// Anything else is our failure, a 500.
+func transactionError(err error) error {
+	if quoteErr := feeQuoteError(err); quoteErr != nil {
+		return quoteErr
+	}
+	if limitErr := limitError(err); limitErr != nil {
+		return limitErr
+	}
+
+	switch {
+	case errors.Is(err, services.ErrLimitNotConfigured),
+		errors.Is(err, services.ErrStepUpRequired),
+		errors.Is(err, services.ErrStepUpUnavailable),
+		errors.Is(err, services.ErrStepUpFailed):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrWalletNotFound),
+		errors.Is(err, services.ErrRecipientNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrQuoteNotFound):
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	case errors.Is(err, services.ErrRateUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, services.ErrNonPositiveAmount),
+		errors.Is(err, services.ErrInsufficientBalance),
+		errors.Is(err, services.ErrFeeExceedsAmount),
+		errors.Is(err, services.ErrSelfTransfer),
+		errors.Is(err, services.ErrSameCurrency),
+		errors.Is(err, services.ErrAmountTooSmall),
+		errors.Is(err, money.ErrUnsupportedCurrency),
+		errors.Is(err, money.ErrInvalidAmount):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "could not complete the transaction").SetInternal(err)
+	}
+}
 func (h *WalletHandler) GetTransactionHistory(c echo.Context) error {
 	userID := c.Get("userID").(uuid.UUID)
 
 	txnType := c.QueryParam("type")
 	status := c.QueryParam("status")
+	currency := c.QueryParam("currency")
 
 	limit := 50
 	if l := c.QueryParam("limit"); l != "" {
@@ -95,10 +164,28 @@ func (h *WalletHandler) GetTransactionHistory(c echo.Context) error {
 		}
 	}
 
-	transactions, err := h.WalletService.GetTransactions(userID, txnType, status, limit)
+	transactions, err := h.WalletService.GetTransactions(userID, txnType, status, currency, limit)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch transactions"})
 	}
 
 	return c.JSON(http.StatusOK, transactions)
 }
+
+func (h *WalletHandler) GetLedger(c echo.Context) error {
+	userID := c.Get("userID").(uuid.UUID)
+
+	limit := 50
+	if l := c.QueryParam("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	postings, err := h.WalletService.GetLedger(userID, strings.ToUpper(c.QueryParam("currency")), limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch ledger"})
+	}
+
+	return c.JSON(http.StatusOK, postings)
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import "github.com/google/uuid"
+
+// KYCChecker reports how far a user's identity has been verified.
+type KYCChecker interface {
+	// Level returns the verification level the user holds; zero means
+	// unverified.
+	Level(userID uuid.UUID) (int, error)
+}
@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"context"
+	"math/big"
+)
+
+// RateProvider quotes exchange rates between wallet currencies.
+type RateProvider interface {
+	// Rate returns how many units of `to` one unit of `from` buys.
+	Rate(ctx context.Context, from, to string) (*big.Rat, error)
+}
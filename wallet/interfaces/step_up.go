@@ -0,0 +1,11 @@
+package interfaces
+
+import "github.com/google/uuid"
+
+// StepUpVerifier checks a second factor before a sensitive wallet operation.
+type StepUpVerifier interface {
+	// Enabled reports whether the user has a second factor set up.
+	Enabled(userID uuid.UUID) (bool, error)
+	// Verify returns nil if code is a valid, unused second-factor code.
+	Verify(userID uuid.UUID, code string) error
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// TaskRunner runs work in the background that shutdown waits for. ctx is
+// cancelled when the process is stopping.
+type TaskRunner interface {
+	Go(name string, task func(ctx context.Context))
+}
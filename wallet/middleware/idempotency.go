@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+
+	idempotencyTTL     = 24 * time.Hour
+	idempotencyLockTTL = 30 * time.Second
+	maxIdempotencyKey  = 255
+)
+
+// idempotentResponse is what gets replayed for a retried request.
+type idempotentResponse struct {
+	RequestHash string `json:"request_hash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// responseRecorder tees everything the handler writes so it can be stored.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware makes a mutation safe to retry. When a request
+// carries an Idempotency-Key header the first response is stored per user
+// and key; an identical retry gets that response back, a retry with a
+// different body is rejected with 422, and a retry that arrives while the
+// first is still running gets 409. Requests without the header pass through.
+// It must run after AuthMiddleware so keys are scoped to the caller.
+func IdempotencyMiddleware(redisClient *redis.Client) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKey {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "Idempotency-Key is too long"})
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "failed to read request body"})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewBuffer(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(c.Request().Method + " " + c.Path() + "\n"))
+			hash.Write(body)
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			ctx := c.Request().Context()
+			recordKey := fmt.Sprintf("idempotency:%v:%s", c.Get("userID"), key)
+			lockKey := recordKey + ":lock"
+
+			if replayed, err := replay(c, redisClient, recordKey, requestHash); replayed || err != nil {
+				return err
+			}
+
+			locked, err := redisClient.SetNX(ctx, lockKey, requestHash, idempotencyLockTTL).Result()
+			if err != nil {
+				return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "idempotency store unavailable"})
+			}
+			if !locked {
+				return c.JSON(http.StatusConflict, echo.Map{"error": "a request with this Idempotency-Key is already in progress"})
+			}
+			defer redisClient.Del(context.Background(), lockKey)
+
+			// The first request may have finished between the lookup and the lock.
+			if replayed, err := replay(c, redisClient, recordKey, requestHash); replayed || err != nil {
+				return err
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			if err := next(c); err != nil {
+				// Render the error now so its response can be stored too.
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				// Let the client retry server-side failures for real.
+				return nil
+			}
+
+			record, _ := json.Marshal(idempotentResponse{
+				RequestHash: requestHash,
+				Status:      status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        recorder.body.Bytes(),
+			})
+			if err := redisClient.Set(ctx, recordKey, record, idempotencyTTL).Err(); err != nil {
+				c.Logger().Errorf("failed to store idempotent response: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+// replay writes the stored response for recordKey, if there is one.
+func replay(c echo.Context, redisClient *redis.Client, recordKey, requestHash string) (bool, error) {
+	data, err := redisClient.Get(c.Request().Context(), recordKey).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return true, c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "idempotency store unavailable"})
+	}
+
+	var stored idempotentResponse
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return false, nil
+	}
+	if stored.RequestHash != requestHash {
+		return true, c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Idempotency-Key was already used with a different request"})
+	}
+
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return true, c.Blob(stored.Status, stored.ContentType, stored.Body)
+}
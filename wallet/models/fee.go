@@ -2,22 +2,101 @@ package models
 
 import (
 	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 )
 
-type UserTier string
+// UserTier is the tier a user is priced at; see package tier.
+type UserTier = tier.Tier
 
 const (
-	BasicTier   UserTier = "basic"
-	PremiumTier UserTier = "premium"
+	BasicTier      = tier.Basic
+	PremiumTier    = tier.Premium
+	EnterpriseTier = tier.Enterprise
 )
 
+// NormalizeTier maps the tier stored on a user ("Premium", "basic", "") to
+// one of the known tiers. Unknown values are treated as basic.
+func NormalizeTier(s string) UserTier {
+	return tier.Normalize(s)
+}
+
+// FeeBracket replaces the base percent and flat fee for amounts in
+// [MinAmount, MaxAmount). A nil MaxAmount has no upper bound.
+type FeeBracket struct {
+	MinAmount money.Amount  `json:"min_amount"`
+	MaxAmount *money.Amount `json:"max_amount,omitempty"`
+	Percent   float64       `json:"percent"`
+	FlatFee   money.Amount  `json:"flat_fee"`
+}
+
+// PeakWindow is a daily time range, in the config's timezone, during which
+// the peak surcharge applies. Start and End are "HH:MM"; an End before Start
+// runs past midnight. Weekdays are 0 (Sunday) to 6; empty means every day.
+type PeakWindow struct {
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	Start    string         `json:"start"`
+	End      string         `json:"end"`
+}
+
+// FeeConfig is one version of the fee rule for a transaction type and tier.
+// Versions are never edited in place: a new row takes over from
+// EffectiveFrom and the old one is closed with EffectiveTo, so any past
+// transaction can be re-priced with the rule that was live at the time.
 type FeeConfig struct {
-	TransactionType string    `json:"transaction_type"`
-	Tier            UserTier  `json:"tier"`
-	BasePercent     float64   `json:"base_percent"`
-	Cap             float64   `json:"cap"`
-	Floor           float64   `json:"floor"`
-	PeakStart       time.Time `json:"peak_start"`
-	PeakEnd         time.Time `json:"peak_end"`
-	PeakSurcharge   float64   `json:"peak_surcharge"` // extra percent during peak
+	ID              uint                            `json:"id" gorm:"primaryKey"`
+	TransactionType TransactionType                 `json:"transaction_type" gorm:"type:varchar(20);not null;index:idx_fee_configs_lookup"`
+	Tier            UserTier                        `json:"tier" gorm:"type:varchar(20);not null;index:idx_fee_configs_lookup"`
+	Version         int                             `json:"version" gorm:"not null"`
+	FlatFee         money.Amount                    `json:"flat_fee"`
+	BasePercent     float64                         `json:"base_percent"`
+	Brackets        datatypes.JSONSlice[FeeBracket] `json:"brackets"`
+	Cap             *money.Amount                   `json:"cap,omitempty"`
+	Floor           money.Amount                    `json:"floor"`
+	PeakWindows     datatypes.JSONSlice[PeakWindow] `json:"peak_windows"`
+	PeakSurcharge   float64                         `json:"peak_surcharge"` // extra percent during peak
+	Timezone        string                          `json:"timezone" gorm:"type:varchar(64);default:'UTC'"`
+	EffectiveFrom   time.Time                       `json:"effective_from" gorm:"not null"`
+	EffectiveTo     *time.Time                      `json:"effective_to,omitempty"`
+	CreatedAt       time.Time                       `json:"created_at"`
+}
+
+// EffectiveAt reports whether this version was the live rule at t.
+func (fc FeeConfig) EffectiveAt(t time.Time) bool {
+	if t.Before(fc.EffectiveFrom) {
+		return false
+	}
+	return fc.EffectiveTo == nil || t.Before(*fc.EffectiveTo)
+}
+
+// FeeConfigAudit records who changed a fee rule and what it looked like
+// before and after.
+type FeeConfigAudit struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	FeeConfigID uint           `json:"fee_config_id" gorm:"not null;index"`
+	Action      string         `json:"action" gorm:"type:varchar(20);not null"`
+	ActorID     uuid.UUID      `json:"actor_id" gorm:"type:uuid;not null"`
+	Before      datatypes.JSON `json:"before,omitempty"`
+	After       datatypes.JSON `json:"after,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// FeeQuote is a dry-run price for a transaction. Presenting Token with the
+// same transaction before ExpiresAt charges exactly Fee. NetAmount is what
+// the wallet then moves by: the amount plus the fee for a withdrawal, less
+// it for a deposit.
+type FeeQuote struct {
+	Token       string                 `json:"quote_token"`
+	Type        TransactionType        `json:"type"`
+	Amount      money.Amount           `json:"amount"`
+	Currency    string                 `json:"currency"`
+	Fee         money.Amount           `json:"fee"`
+	NetAmount   money.Amount           `json:"net_amount"`
+	Breakdown   map[string]interface{} `json:"fee_breakdown"`
+	FeeConfigID *uint                  `json:"fee_config_id,omitempty"`
+	ExpiresAt   time.Time              `json:"expires_at"`
 }
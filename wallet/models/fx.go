@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/money"
+)
+
+// FXQuote locks a conversion rate for a short window. It lives in Redis
+// until it is executed or expires.
+type FXQuote struct {
+	ID              string       `json:"quote_id"`
+	UserID          uuid.UUID    `json:"user_id"`
+	FromCurrency    string       `json:"from_currency"`
+	ToCurrency      string       `json:"to_currency"`
+	Amount          money.Amount `json:"amount"`
+	Rate            string       `json:"rate"`
+	SpreadPercent   float64      `json:"spread_percent"`
+	Fee             money.Amount `json:"fee"`
+	ConvertedAmount money.Amount `json:"converted_amount"`
+	ExpiresAt       time.Time    `json:"expires_at"`
+}
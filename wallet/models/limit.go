@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/nazrawigedion123/wallet-backend/money"
+)
+
+// LimitWindow is a rolling period that totals are counted over.
+type LimitWindow string
+
+const (
+	DailyWindow   LimitWindow = "daily"
+	WeeklyWindow  LimitWindow = "weekly"
+	MonthlyWindow LimitWindow = "monthly"
+)
+
+// LimitWindows lists the windows from shortest to longest.
+var LimitWindows = []LimitWindow{DailyWindow, WeeklyWindow, MonthlyWindow}
+
+// Duration is how far back the window reaches.
+func (w LimitWindow) Duration() time.Duration {
+	switch w {
+	case DailyWindow:
+		return 24 * time.Hour
+	case WeeklyWindow:
+		return 7 * 24 * time.Hour
+	default:
+		return 30 * 24 * time.Hour
+	}
+}
+
+// TierLimit caps one transaction type for one tier and currency. A nil field
+// means no limit; a tier, type and currency with no row is unlimited.
+// KYCLevel is the verification level the row applies from: a user gets the
+// row with the highest level they hold.
+type TierLimit struct {
+	ID                uint            `json:"id" gorm:"primaryKey"`
+	Tier              UserTier        `json:"tier" gorm:"type:varchar(20);not null;uniqueIndex:idx_tier_limits_scope"`
+	TransactionType   TransactionType `json:"transaction_type" gorm:"type:varchar(20);not null;uniqueIndex:idx_tier_limits_scope"`
+	Currency          string          `json:"currency" gorm:"type:varchar(3);not null;uniqueIndex:idx_tier_limits_scope"`
+	KYCLevel          int             `json:"kyc_level" gorm:"not null;default:0;uniqueIndex:idx_tier_limits_scope"`
+	MaxPerTransaction *money.Amount   `json:"max_per_transaction"`
+	DailyAmount       *money.Amount   `json:"daily_amount"`
+	DailyCount        *int64          `json:"daily_count"`
+	WeeklyAmount      *money.Amount   `json:"weekly_amount"`
+	WeeklyCount       *int64          `json:"weekly_count"`
+	MonthlyAmount     *money.Amount   `json:"monthly_amount"`
+	MonthlyCount      *int64          `json:"monthly_count"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// Window returns the amount and count caps for w.
+func (l TierLimit) Window(w LimitWindow) (*money.Amount, *int64) {
+	switch w {
+	case DailyWindow:
+		return l.DailyAmount, l.DailyCount
+	case WeeklyWindow:
+		return l.WeeklyAmount, l.WeeklyCount
+	default:
+		return l.MonthlyAmount, l.MonthlyCount
+	}
+}
+
+// WindowUsage is how much of one window's limits a user has used.
+type WindowUsage struct {
+	Window          LimitWindow   `json:"window"`
+	MaxAmount       *money.Amount `json:"max_amount"`
+	UsedAmount      money.Amount  `json:"used_amount"`
+	RemainingAmount *money.Amount `json:"remaining_amount"`
+	MaxCount        *int64        `json:"max_count"`
+	UsedCount       int64         `json:"used_count"`
+	RemainingCount  *int64        `json:"remaining_count"`
+	// ResetsAt is when the oldest transaction in the window drops out of it.
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// LimitUsage is a user's standing against the limits for one transaction
+// type.
+type LimitUsage struct {
+	TransactionType   TransactionType `json:"transaction_type"`
+	Currency          string          `json:"currency"`
+	Tier              UserTier        `json:"tier"`
+	KYCLevel          int             `json:"kyc_level"`
+	MaxPerTransaction *money.Amount   `json:"max_per_transaction"`
+	Windows           []WindowUsage   `json:"windows"`
+}
+
+// KYCRequirement is the verification level a user needs before they may
+// make a type of transaction. Types with no row need none.
+type KYCRequirement struct {
+	TransactionType TransactionType `json:"transaction_type" gorm:"type:varchar(20);primaryKey"`
+	MinLevel        int             `json:"min_level" gorm:"not null;default:0"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
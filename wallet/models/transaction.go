@@ -1,18 +1,29 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/money"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type TransactionType string
 type TransactionStatus string
+type TransactionDirection string
 
 const (
 	DepositTransaction  TransactionType = "deposit"
 	WithdrawTransaction TransactionType = "withdraw"
+	ConvertTransaction  TransactionType = "convert"
+	TransferTransaction TransactionType = "transfer"
+	// TierUpgradeTransaction pays for moving to a higher tier.
+	TierUpgradeTransaction TransactionType = "tier_upgrade"
+
+	Credit TransactionDirection = "credit"
+	Debit  TransactionDirection = "debit"
 
 	StatusPending TransactionStatus = "pending"
 	StatusSuccess TransactionStatus = "success"
@@ -21,20 +32,69 @@ const (
 
 type Transaction struct {
 	gorm.Model
-	UserID uuid.UUID         `json:"user_id" gorm:"type:uuid;not null;index"`
-	Amount float64           `json:"amount" gorm:"not null"`
-	Type   TransactionType   `json:"type" gorm:"type:varchar(20);not null"`
-	Status TransactionStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	UserID    uuid.UUID            `json:"user_id" gorm:"type:uuid;not null;index"`
+	Amount    money.Amount         `json:"amount" gorm:"not null"`
+	Currency  string               `json:"currency" gorm:"type:varchar(3);not null;default:'USD'"`
+	Type      TransactionType      `json:"type" gorm:"type:varchar(20);not null"`
+	Direction TransactionDirection `json:"direction" gorm:"type:varchar(10)"`
+	Status    TransactionStatus    `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
 
 	User         models.User    `json:"-" gorm:"foreignKey:UserID;references:ID"`
-	Fee          float64        `json:"fee"`
-	NetAmount    float64        `json:"net_amount"`
+	Fee          money.Amount   `json:"fee"`
+	NetAmount    money.Amount   `json:"net_amount"`
 	FeeBreakdown datatypes.JSON `json:"fee_breakdown"`
+	// FeeConfigID is the fee rule version the fee was priced with.
+	FeeConfigID *uint `json:"fee_config_id,omitempty"`
+
+	// QuoteID links the two legs of a currency conversion.
+	QuoteID string `json:"quote_id,omitempty" gorm:"index"`
+	// TransferID links the debit and credit legs of a peer-to-peer transfer.
+	TransferID     *uuid.UUID `json:"transfer_id,omitempty" gorm:"type:uuid;index"`
+	CounterpartyID *uuid.UUID `json:"counterparty_id,omitempty" gorm:"type:uuid"`
 }
 
+// WalletBalance is one of a user's wallets; a user holds at most one per currency.
 type WalletBalance struct {
-	UserID  uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
-	Balance float64   `json:"balance" gorm:"not null;default:0"`
+	UserID   uuid.UUID    `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Currency string       `json:"currency" gorm:"type:varchar(3);primaryKey;default:'USD'"`
+	Balance  money.Amount `json:"balance" gorm:"not null;default:0"`
 
 	User models.User `gorm:"foreignKey:UserID;references:ID"`
 }
+
+// TransactionTopic is the outbox topic every committed transaction, and
+// every later change to its status, is published on.
+const TransactionTopic = "wallet:transactions"
+
+// TransactionEvent is the message published on TransactionTopic.
+type TransactionEvent struct {
+	TransactionID  uint                 `json:"transaction_id"`
+	UserID         uuid.UUID            `json:"user_id"`
+	Type           TransactionType      `json:"type"`
+	Direction      TransactionDirection `json:"direction"`
+	Status         TransactionStatus    `json:"status"`
+	Amount         money.Amount         `json:"amount"`
+	Fee            money.Amount         `json:"fee"`
+	Currency       string               `json:"currency"`
+	QuoteID        string               `json:"quote_id,omitempty"`
+	TransferID     *uuid.UUID           `json:"transfer_id,omitempty"`
+	CounterpartyID *uuid.UUID           `json:"counterparty_id,omitempty"`
+	OccurredAt     time.Time            `json:"occurred_at"`
+}
+
+func NewTransactionEvent(txn *Transaction) TransactionEvent {
+	return TransactionEvent{
+		TransactionID:  txn.ID,
+		UserID:         txn.UserID,
+		Type:           txn.Type,
+		Direction:      txn.Direction,
+		Status:         txn.Status,
+		Amount:         txn.Amount,
+		Fee:            txn.Fee,
+		Currency:       txn.Currency,
+		QuoteID:        txn.QuoteID,
+		TransferID:     txn.TransferID,
+		CounterpartyID: txn.CounterpartyID,
+		OccurredAt:     time.Now(),
+	}
+}
@@ -3,21 +3,66 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/nazrawigedion123/wallet-backend/auth/middleware"
+	"github.com/nazrawigedion123/wallet-backend/auth/models"
 	"github.com/nazrawigedion123/wallet-backend/auth/services"
 	"github.com/nazrawigedion123/wallet-backend/wallet/handlers"
+	walletMiddleware "github.com/nazrawigedion123/wallet-backend/wallet/middleware"
+	"github.com/redis/go-redis/v9"
 )
 
-func RegisterWalletRoutes(e *echo.Group, walletHandler *handlers.WalletHandler, sessionSvc *services.SessionService) {
+// RegisterWalletRoutes serves the wallet to sessions and to API keys. Keys
+// need wallet:read to look and wallet:write to move money; quotes only look.
+func RegisterWalletRoutes(e *echo.Group, walletHandler *handlers.WalletHandler, sessionSvc *services.SessionService, apiKeySvc *services.APIKeyService, redisClient *redis.Client) {
 	walletGroup := e.Group("")
-	walletGroup.Use(middleware.AuthMiddleware(sessionSvc))
-	walletGroup.GET("/wallet/balance", walletHandler.GetBalance)
-	walletGroup.POST("/wallet/deposit", walletHandler.Deposit)
-	walletGroup.POST("/wallet/withdraw", walletHandler.Withdraw)
-	walletGroup.GET("/wallet/transactions", walletHandler.GetTransactionHistory)
+	walletGroup.Use(middleware.AuthOrAPIKey(sessionSvc, apiKeySvc))
+	idempotent := walletMiddleware.IdempotencyMiddleware(redisClient)
+	canRead := middleware.RequireScope(models.ScopeWalletRead)
+	canWrite := middleware.RequireScope(models.ScopeWalletWrite)
+
+	walletGroup.GET("/wallet/balance", walletHandler.GetBalance, canRead)
+	walletGroup.POST("/wallet/quote", walletHandler.QuoteFee, canRead)
+	walletGroup.GET("/wallet/limits", walletHandler.GetLimits, canRead)
+	walletGroup.POST("/wallet/deposit", walletHandler.Deposit, canWrite, idempotent)
+	walletGroup.POST("/wallet/withdraw", walletHandler.Withdraw, canWrite, idempotent)
+	walletGroup.GET("/wallet/transactions", walletHandler.GetTransactionHistory, canRead)
+	walletGroup.GET("/wallet/ledger", walletHandler.GetLedger, canRead)
+	walletGroup.POST("/wallet/convert/quote", walletHandler.ConvertQuote, canRead)
+	walletGroup.POST("/wallet/convert", walletHandler.Convert, canWrite, idempotent)
+	walletGroup.POST("/wallet/transfer", walletHandler.Transfer, canWrite, idempotent)
+}
+
+// RegisterFeeAdminRoutes exposes fee schedule management to staff roles.
+func RegisterFeeAdminRoutes(e *echo.Group, walletHandler *handlers.WalletHandler, sessionSvc *services.SessionService) {
+	feeGroup := e.Group("/admin/fees")
+	feeGroup.Use(middleware.AuthMiddleware(sessionSvc))
+	canView := middleware.RequirePermission(models.PermViewFees)
+	canManage := middleware.RequirePermission(models.PermManageFees)
+
+	feeGroup.GET("", walletHandler.ListFeeConfigs, canView)
+	feeGroup.POST("", walletHandler.CreateFeeConfig, canManage)
+	feeGroup.POST("/preview", walletHandler.PreviewFee, canView)
+	feeGroup.GET("/audit", walletHandler.GetFeeAudit, canView)
+	feeGroup.GET("/:id", walletHandler.GetFeeConfig, canView)
+	feeGroup.POST("/:id/retire", walletHandler.RetireFeeConfig, canManage)
+}
+
+// RegisterLimitAdminRoutes exposes per-tier transaction limits to staff roles.
+func RegisterLimitAdminRoutes(e *echo.Group, walletHandler *handlers.WalletHandler, sessionSvc *services.SessionService) {
+	limitGroup := e.Group("/admin/limits")
+	limitGroup.Use(middleware.AuthMiddleware(sessionSvc))
+	canView := middleware.RequirePermission(models.PermViewLimits)
+	canManage := middleware.RequirePermission(models.PermManageLimits)
+
+	limitGroup.GET("", walletHandler.ListTierLimits, canView)
+	limitGroup.PUT("", walletHandler.SetTierLimit, canManage)
+	limitGroup.DELETE("/:id", walletHandler.DeleteTierLimit, canManage)
+	limitGroup.GET("/kyc", walletHandler.ListKYCRequirements, canView)
+	limitGroup.PUT("/kyc", walletHandler.SetKYCRequirement, canManage)
 }
 
-func RegisterSimulationRoutes(e *echo.Group, walletHandler *handlers.WalletHandler){
-	simGroup := e.Group("")
+func RegisterSimulationRoutes(e *echo.Group, walletHandler *handlers.WalletHandler, sessionSvc *services.SessionService) {
+	simGroup := e.Group("/admin")
+	simGroup.Use(middleware.AuthMiddleware(sessionSvc), middleware.RequirePermission(models.PermRunSimulation))
 
 	simGroup.POST("/simulate/users", walletHandler.SimulateUsers)
 }
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+var (
+	ErrInvalidFeeConfig  = errors.New("invalid fee config")
+	ErrFeeConfigNotFound = errors.New("fee config not found")
+	ErrFeeCoverageGap    = errors.New("change would leave a tier without a fee rule")
+)
+
+const (
+	feeAuditCreate = "create"
+	feeAuditRetire = "retire"
+	// feeAuditRestore reopens a version whose successor was retired before
+	// it took effect.
+	feeAuditRestore = "restore"
+)
+
+// feeTransactionTypes are the transaction types priced by FeeService.
+// Conversions are priced by the FX spread instead.
+var feeTransactionTypes = []models.TransactionType{
+	models.DepositTransaction,
+	models.WithdrawTransaction,
+	models.TransferTransaction,
+}
+
+var feeTiers = []models.UserTier{models.BasicTier, models.PremiumTier, models.EnterpriseTier}
+
+// ListConfigs returns rule versions, newest first. Empty filters match
+// everything; retired versions are only included when asked for.
+func (fs *FeeService) ListConfigs(txnType string, tier string, includeRetired bool) ([]models.FeeConfig, error) {
+	query := fs.db.Order("transaction_type, tier, version desc")
+	if txnType != "" {
+		query = query.Where("transaction_type = ?", txnType)
+	}
+	if tier != "" {
+		query = query.Where("tier = ?", tier)
+	}
+	if !includeRetired {
+		query = query.Where("effective_to IS NULL OR effective_to > ?", time.Now())
+	}
+
+	var configs []models.FeeConfig
+	err := query.Find(&configs).Error
+	return configs, err
+}
+
+func (fs *FeeService) GetConfig(id uint) (*models.FeeConfig, error) {
+	var config models.FeeConfig
+	if err := fs.db.First(&config, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFeeConfigNotFound
+		}
+		return nil, err
+	}
+	return &config, nil
+}
+
+// GetAudit returns the change history, optionally for a single rule.
+func (fs *FeeService) GetAudit(feeConfigID uint, limit int) ([]models.FeeConfigAudit, error) {
+	query := fs.db.Order("created_at desc")
+	if feeConfigID != 0 {
+		query = query.Where("fee_config_id = ?", feeConfigID)
+	}
+	if limit == 0 {
+		limit = 50
+	}
+
+	var audit []models.FeeConfigAudit
+	err := query.Limit(limit).Find(&audit).Error
+	return audit, err
+}
+
+// CreateConfig publishes a new version of the rule for config's transaction
+// type and tier. It takes over from EffectiveFrom (now if unset), which
+// closes the version it replaces at the same instant so there is never a
+// gap or an overlap between versions.
+func (fs *FeeService) CreateConfig(actorID uuid.UUID, config models.FeeConfig) (*models.FeeConfig, error) {
+	now := time.Now()
+	if config.EffectiveFrom.IsZero() {
+		config.EffectiveFrom = now
+	}
+	if config.EffectiveFrom.Before(now.Add(-time.Minute)) {
+		return nil, fmt.Errorf("%w: effective_from cannot be in the past", ErrInvalidFeeConfig)
+	}
+	if config.Timezone == "" {
+		config.Timezone = "UTC"
+	}
+	config.ID = 0
+	config.EffectiveTo = nil
+	if err := ValidateFeeConfig(config); err != nil {
+		return nil, err
+	}
+
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		current, err := fs.openConfig(tx, config.TransactionType, config.Tier)
+		if err != nil {
+			return err
+		}
+
+		if config.Tier != models.BasicTier {
+			basic, err := fs.openConfig(tx, config.TransactionType, models.BasicTier)
+			if err != nil {
+				return err
+			}
+			if basic == nil {
+				return fmt.Errorf("%w: create the basic rule for %s first", ErrFeeCoverageGap, config.TransactionType)
+			}
+		}
+
+		var latest int
+		if err := tx.Model(&models.FeeConfig{}).
+			Where("transaction_type = ? AND tier = ?", config.TransactionType, config.Tier).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		config.Version = latest + 1
+
+		if current != nil {
+			if !config.EffectiveFrom.After(current.EffectiveFrom) {
+				return fmt.Errorf("%w: version %d already starts at %s; retire it first",
+					ErrInvalidFeeConfig, current.Version, current.EffectiveFrom.Format(time.RFC3339))
+			}
+			before := *current
+			current.EffectiveTo = &config.EffectiveFrom
+			if err := tx.Save(current).Error; err != nil {
+				return err
+			}
+			if err := fs.audit(tx, actorID, current.ID, feeAuditRetire, &before, current); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&config).Error; err != nil {
+			return err
+		}
+		return fs.audit(tx, actorID, config.ID, feeAuditCreate, nil, &config)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fs.announceReload()
+	return &config, nil
+}
+
+// RetireConfig ends a rule version at the given time (now if zero). Only
+// the open-ended version of a type and tier can be retired. Retiring a
+// version before it takes effect hands coverage back to the version it
+// would have replaced. The basic rule cannot be retired while other tiers
+// of the same type still fall back to it.
+func (fs *FeeService) RetireConfig(actorID uuid.UUID, id uint, at time.Time) (*models.FeeConfig, error) {
+	now := time.Now()
+	if at.IsZero() {
+		at = now
+	}
+	if at.Before(now.Add(-time.Minute)) {
+		return nil, fmt.Errorf("%w: a rule cannot be retired in the past", ErrInvalidFeeConfig)
+	}
+
+	var retired models.FeeConfig
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&retired, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrFeeConfigNotFound
+			}
+			return err
+		}
+		if retired.EffectiveTo != nil {
+			return fmt.Errorf("%w: version %d is already retired or replaced", ErrInvalidFeeConfig, retired.Version)
+		}
+		before := retired
+
+		// A version retired before it starts never applies; its predecessor
+		// stays in force.
+		if !at.After(retired.EffectiveFrom) {
+			at = retired.EffectiveFrom
+			var previous models.FeeConfig
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("transaction_type = ? AND tier = ? AND effective_to = ?", retired.TransactionType, retired.Tier, retired.EffectiveFrom).
+				First(&previous).Error
+			if err == nil {
+				previousBefore := previous
+				previous.EffectiveTo = nil
+				if err := tx.Save(&previous).Error; err != nil {
+					return err
+				}
+				if err := fs.audit(tx, actorID, previous.ID, feeAuditRestore, &previousBefore, &previous); err != nil {
+					return err
+				}
+				retired.EffectiveTo = &at
+				if err := tx.Save(&retired).Error; err != nil {
+					return err
+				}
+				return fs.audit(tx, actorID, retired.ID, feeAuditRetire, &before, &retired)
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if retired.Tier == models.BasicTier {
+			var dependents int64
+			if err := tx.Model(&models.FeeConfig{}).
+				Where("transaction_type = ? AND tier <> ? AND effective_to IS NULL", retired.TransactionType, models.BasicTier).
+				Count(&dependents).Error; err != nil {
+				return err
+			}
+			if dependents > 0 {
+				return fmt.Errorf("%w: retire the other %s tiers before the basic rule", ErrFeeCoverageGap, retired.TransactionType)
+			}
+		}
+
+		retired.EffectiveTo = &at
+		if err := tx.Save(&retired).Error; err != nil {
+			return err
+		}
+		return fs.audit(tx, actorID, retired.ID, feeAuditRetire, &before, &retired)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fs.announceReload()
+	return &retired, nil
+}
+
+// Preview prices amount with a draft rule without saving it.
+func (fs *FeeService) Preview(config models.FeeConfig, amount money.Amount, at time.Time) (FeeResult, error) {
+	if config.Timezone == "" {
+		config.Timezone = "UTC"
+	}
+	if err := ValidateFeeConfig(config); err != nil {
+		return FeeResult{}, err
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	fee, breakdown := calculateFee(amount, config, at)
+	return FeeResult{Fee: fee, Breakdown: breakdown}, nil
+}
+
+// openConfig returns the open-ended version for a type and tier, locked for
+// update, or nil if there is none.
+func (fs *FeeService) openConfig(tx *gorm.DB, txnType models.TransactionType, tier models.UserTier) (*models.FeeConfig, error) {
+	var config models.FeeConfig
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("transaction_type = ? AND tier = ? AND effective_to IS NULL", txnType, tier).
+		Order("effective_from desc").
+		First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (fs *FeeService) audit(tx *gorm.DB, actorID uuid.UUID, feeConfigID uint, action string, before, after *models.FeeConfig) error {
+	entry := models.FeeConfigAudit{
+		FeeConfigID: feeConfigID,
+		Action:      action,
+		ActorID:     actorID,
+	}
+	if before != nil {
+		entry.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		entry.After, _ = json.Marshal(after)
+	}
+	return tx.Create(&entry).Error
+}
+
+// ValidateFeeConfig checks a rule on its own: known type and tier, sane
+// percentages, cap at or above floor, ordered non-overlapping brackets and
+// non-overlapping peak windows in a valid timezone.
+func ValidateFeeConfig(config models.FeeConfig) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidFeeConfig, fmt.Sprintf(format, args...))
+	}
+
+	if !containsType(feeTransactionTypes, config.TransactionType) {
+		return invalid("unsupported transaction_type %q", config.TransactionType)
+	}
+	if !containsTier(feeTiers, config.Tier) {
+		return invalid("unsupported tier %q", config.Tier)
+	}
+	if !validPercent(config.BasePercent) || !validPercent(config.PeakSurcharge) {
+		return invalid("percentages must be between 0 and 100")
+	}
+	if config.FlatFee < 0 || config.Floor < 0 {
+		return invalid("flat_fee and floor cannot be negative")
+	}
+	if config.Cap != nil && *config.Cap < config.Floor {
+		return invalid("cap %s is below floor %s", *config.Cap, config.Floor)
+	}
+
+	for i, bracket := range config.Brackets {
+		if bracket.MinAmount < 0 || bracket.FlatFee < 0 || !validPercent(bracket.Percent) {
+			return invalid("bracket %d has a negative amount or an invalid percent", i)
+		}
+		if bracket.MaxAmount != nil && *bracket.MaxAmount <= bracket.MinAmount {
+			return invalid("bracket %d max_amount must be above min_amount", i)
+		}
+		if i > 0 {
+			previous := config.Brackets[i-1]
+			if previous.MaxAmount == nil || bracket.MinAmount < *previous.MaxAmount {
+				return invalid("bracket %d overlaps bracket %d; list brackets in ascending order", i, i-1)
+			}
+		}
+	}
+
+	if _, err := time.LoadLocation(config.Timezone); err != nil {
+		return invalid("unknown timezone %q", config.Timezone)
+	}
+
+	// Lay every window out on a minute-of-week line and look for overlaps.
+	type span struct{ start, end, window int }
+	const day, week = 24 * 60, 7 * 24 * 60
+	var spans []span
+	for i, window := range config.PeakWindows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return invalid("peak window %d: %v", i, err)
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return invalid("peak window %d: %v", i, err)
+		}
+		if start == end {
+			return invalid("peak window %d is empty", i)
+		}
+		length := end - start
+		if length < 0 {
+			length += day
+		}
+
+		weekdays := window.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+		}
+		for _, weekday := range weekdays {
+			if weekday < time.Sunday || weekday > time.Saturday {
+				return invalid("peak window %d has an invalid weekday %d", i, weekday)
+			}
+			from := int(weekday)*day + start
+			to := from + length
+			if to > week {
+				spans = append(spans, span{from, week, i}, span{0, to - week, i})
+			} else {
+				spans = append(spans, span{from, to, i})
+			}
+		}
+	}
+	sort.Slice(spans, func(a, b int) bool { return spans[a].start < spans[b].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			if spans[i].window == spans[i-1].window {
+				return invalid("peak window %d lists the same weekday twice", spans[i].window)
+			}
+			return invalid("peak windows %d and %d overlap", spans[i-1].window, spans[i].window)
+		}
+	}
+
+	return nil
+}
+
+func validPercent(p float64) bool {
+	return p >= 0 && p <= 100
+}
+
+func containsType(types []models.TransactionType, t models.TransactionType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTier(tiers []models.UserTier, t models.UserTier) bool {
+	for _, candidate := range tiers {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
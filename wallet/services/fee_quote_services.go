@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+var (
+	ErrInvalidFeeQuote = errors.New("invalid fee quote")
+	ErrFeeQuoteExpired = errors.New("fee quote has expired")
+	ErrFeeQuoteUsed    = errors.New("fee quote has already been used")
+)
+
+// feeQuoteClaims is the signed body of a quote token. The breakdown travels
+// inside the token so redeeming it needs no server-side state beyond the
+// single-use marker.
+type feeQuoteClaims struct {
+	ID          string                 `json:"id"`
+	UserID      uuid.UUID              `json:"user_id"`
+	Type        models.TransactionType `json:"type"`
+	Amount      money.Amount           `json:"amount"`
+	Currency    string                 `json:"currency"`
+	Fee         money.Amount           `json:"fee"`
+	FeeConfigID *uint                  `json:"fee_config_id,omitempty"`
+	Breakdown   json.RawMessage        `json:"breakdown"`
+	ExpiresAt   int64                  `json:"exp"`
+}
+
+// Quote prices a transaction the way executing it now would, without moving
+// any money, and signs the result so the caller can lock it in.
+func (fs *FeeService) Quote(userID uuid.UUID, userTier string, txnType models.TransactionType, amount money.Amount, currency string) (*models.FeeQuote, error) {
+	if amount <= 0 {
+		return nil, ErrNonPositiveAmount
+	}
+	if !containsType(feeTransactionTypes, txnType) {
+		return nil, fmt.Errorf("%w: cannot quote %q transactions", ErrInvalidFeeQuote, txnType)
+	}
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	priced := fs.Calculate(txnType, userTier, amount, now)
+	// A quoted fee is charged like any other, so refuse to quote a credit
+	// the fee would swallow.
+	net := netAmount(txnType, amount, priced.Fee)
+	if net < 0 {
+		return nil, fmt.Errorf("%w: fee %s on %s %s", ErrFeeExceedsAmount, priced.Fee, amount, currency)
+	}
+	claims := feeQuoteClaims{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Type:        txnType,
+		Amount:      amount,
+		Currency:    currency,
+		Fee:         priced.Fee,
+		FeeConfigID: priced.ConfigID,
+		Breakdown:   priced.BreakdownJSON(),
+		ExpiresAt:   now.Add(fs.quoteTTL).Unix(),
+	}
+	token, err := fs.signQuote(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FeeQuote{
+		Token:       token,
+		Type:        txnType,
+		Amount:      amount,
+		Currency:    currency,
+		Fee:         priced.Fee,
+		NetAmount:   net,
+		Breakdown:   priced.Breakdown,
+		FeeConfigID: priced.ConfigID,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// Price returns the fee for a transaction about to run. Without a token
+// it is priced from the live rules; with one, the quoted fee is used as long
+// as the token matches the transaction, has not expired and has not been
+// used. On success the caller must call release if the transaction does not
+// go through, so the quote can be used again.
+func (fs *FeeService) Price(userID uuid.UUID, userTier string, txnType models.TransactionType, amount money.Amount, currency string, quoteToken string) (FeeResult, func(), error) {
+	noop := func() {}
+	if quoteToken == "" {
+		return fs.Calculate(txnType, userTier, amount, time.Now()), noop, nil
+	}
+
+	claims, err := fs.verifyQuote(quoteToken)
+	if err != nil {
+		return FeeResult{}, noop, err
+	}
+	if claims.UserID != userID || claims.Type != txnType || claims.Amount != amount || claims.Currency != currency {
+		return FeeResult{}, noop, fmt.Errorf("%w: quote does not match this transaction", ErrInvalidFeeQuote)
+	}
+	remaining := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if remaining <= 0 {
+		return FeeResult{}, noop, ErrFeeQuoteExpired
+	}
+
+	usedKey := fmt.Sprintf("fee:quote:used:%s", claims.ID)
+	claimed, err := fs.redisClient.SetNX(ctx, usedKey, userID.String(), remaining).Result()
+	if err != nil {
+		return FeeResult{}, noop, fmt.Errorf("failed to redeem fee quote: %v", err)
+	}
+	if !claimed {
+		return FeeResult{}, noop, ErrFeeQuoteUsed
+	}
+
+	// Decode numbers as literals so amounts keep their exact decimal text.
+	breakdown := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(claims.Breakdown))
+	decoder.UseNumber()
+	_ = decoder.Decode(&breakdown)
+	breakdown["quote_id"] = claims.ID
+
+	release := func() { fs.redisClient.Del(ctx, usedKey) }
+	return FeeResult{Fee: claims.Fee, Breakdown: breakdown, ConfigID: claims.FeeConfigID}, release, nil
+}
+
+// signQuote encodes claims as base64url(json) + "." + base64url(hmac).
+func (fs *FeeService) signQuote(claims feeQuoteClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(fs.quoteMAC(body)), nil
+}
+
+func (fs *FeeService) verifyQuote(token string) (*feeQuoteClaims, error) {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidFeeQuote
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, fs.quoteMAC(body)) {
+		return nil, ErrInvalidFeeQuote
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrInvalidFeeQuote
+	}
+	var claims feeQuoteClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidFeeQuote
+	}
+	return &claims, nil
+}
+
+func (fs *FeeService) quoteMAC(body string) []byte {
+	mac := hmac.New(sha256.New, fs.quoteSecret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+// FeeResult is a priced fee together with how it was arrived at.
+type FeeResult struct {
+	Fee       money.Amount
+	Breakdown map[string]interface{}
+	// ConfigID is nil when no rule matched and the transaction is free.
+	ConfigID *uint
+}
+
+// BreakdownJSON returns the breakdown in the form stored on a transaction.
+func (r FeeResult) BreakdownJSON() []byte {
+	data, _ := json.Marshal(r.Breakdown)
+	return data
+}
+
+type feeKey struct {
+	txnType models.TransactionType
+	tier    models.UserTier
+}
+
+// FeeService prices transactions from the FeeConfig rules in the database.
+// Rules are kept in memory and swapped wholesale on Reload, so pricing a
+// transaction never waits on a query.
+type FeeService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	quoteSecret []byte
+	quoteTTL    time.Duration
+
+	mu      sync.RWMutex
+	configs map[feeKey][]models.FeeConfig // newest EffectiveFrom first
+}
+
+// feeReloadChannel tells every instance to reload its fee rules after an
+// admin change.
+const feeReloadChannel = "fees:reload"
+
+func NewFeeService(db *gorm.DB, redisClient *redis.Client, quoteSecret string, quoteTTL time.Duration) *FeeService {
+	return &FeeService{
+		db:          db,
+		redisClient: redisClient,
+		quoteSecret: []byte(quoteSecret),
+		quoteTTL:    quoteTTL,
+		configs:     make(map[feeKey][]models.FeeConfig),
+	}
+}
+
+// Reload reads every rule version, including retired ones, so historical
+// lookups keep working.
+func (fs *FeeService) Reload() error {
+	var rows []models.FeeConfig
+	if err := fs.db.Order("effective_from desc, version desc").Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load fee configs: %v", err)
+	}
+
+	configs := make(map[feeKey][]models.FeeConfig)
+	for _, row := range rows {
+		key := feeKey{row.TransactionType, row.Tier}
+		configs[key] = append(configs[key], row)
+	}
+
+	fs.mu.Lock()
+	fs.configs = configs
+	fs.mu.Unlock()
+	return nil
+}
+
+// WatchReloads reloads the rules whenever another instance announces a
+// change, until ctx is cancelled.
+func (fs *FeeService) WatchReloads(ctx context.Context) {
+	sub := fs.redisClient.Subscribe(ctx, feeReloadChannel)
+	defer sub.Close()
+	messages := sub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+			if err := fs.Reload(); err != nil {
+				log.Printf("failed to reload fee configs: %v", err)
+			}
+		}
+	}
+}
+
+// announceReload reloads locally and asks every other instance to do the same.
+func (fs *FeeService) announceReload() {
+	if err := fs.Reload(); err != nil {
+		log.Printf("failed to reload fee configs: %v", err)
+	}
+	if err := fs.redisClient.Publish(ctx, feeReloadChannel, time.Now().Format(time.RFC3339)).Err(); err != nil {
+		log.Printf("failed to announce fee config reload: %v", err)
+	}
+}
+
+// Lookup returns the rule version that was live for txnType and tier at t.
+func (fs *FeeService) Lookup(txnType models.TransactionType, tier models.UserTier, at time.Time) (models.FeeConfig, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	for _, config := range fs.configs[feeKey{txnType, tier}] {
+		if config.EffectiveAt(at) {
+			return config, true
+		}
+	}
+	return models.FeeConfig{}, false
+}
+
+// Calculate prices amount for a transaction of txnType made by a user on
+// userTier at the given time. Tiers without a rule of their own fall back to
+// the basic rule; with no rule at all the transaction is free.
+func (fs *FeeService) Calculate(txnType models.TransactionType, userTier string, amount money.Amount, at time.Time) FeeResult {
+	tier := models.NormalizeTier(userTier)
+
+	config, ok := fs.Lookup(txnType, tier, at)
+	if !ok && tier != models.BasicTier {
+		config, ok = fs.Lookup(txnType, models.BasicTier, at)
+	}
+	if !ok {
+		return FeeResult{Breakdown: map[string]interface{}{"total_fee": money.Amount(0)}}
+	}
+
+	fee, breakdown := calculateFee(amount, config, at)
+	id := config.ID
+	return FeeResult{Fee: fee, Breakdown: breakdown, ConfigID: &id}
+}
+
+// SeedDefaults writes the starting fee schedule when the table is empty.
+// Once any rule exists, the schedule is managed through the database only.
+func (fs *FeeService) SeedDefaults() error {
+	var count int64
+	if err := fs.db.Model(&models.FeeConfig{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	feeCap := money.MustParse("100.00")
+	percents := map[models.UserTier]float64{
+		models.BasicTier:      3,
+		models.PremiumTier:    1,
+		models.EnterpriseTier: 0.5,
+	}
+
+	var defaults []models.FeeConfig
+	for _, txnType := range feeTransactionTypes {
+		for _, tier := range feeTiers {
+			defaults = append(defaults, models.FeeConfig{
+				TransactionType: txnType,
+				Tier:            tier,
+				Version:         1,
+				BasePercent:     percents[tier],
+				Cap:             &feeCap,
+				Floor:           money.MustParse("2.00"),
+				PeakWindows:     []models.PeakWindow{{Start: "17:00", End: "21:00"}},
+				PeakSurcharge:   1,
+				Timezone:        "UTC",
+				EffectiveFrom:   time.Unix(0, 0).UTC(),
+			})
+		}
+	}
+
+	log.Printf("Seeding %d default fee configs", len(defaults))
+	return fs.db.Create(&defaults).Error
+}
+
+// calculateFee applies one rule: a flat part plus a percent of amount (both
+// taken from the matching bracket, if any), a surcharge during peak windows,
+// then the floor and cap.
+func calculateFee(amount money.Amount, config models.FeeConfig, now time.Time) (fee money.Amount, breakdown map[string]interface{}) {
+	breakdown = map[string]interface{}{
+		"fee_config_id":      config.ID,
+		"fee_config_version": config.Version,
+	}
+
+	flat, percent := config.FlatFee, config.BasePercent
+	for i, bracket := range config.Brackets {
+		if amount >= bracket.MinAmount && (bracket.MaxAmount == nil || amount < *bracket.MaxAmount) {
+			flat, percent = bracket.FlatFee, bracket.Percent
+			breakdown["bracket"] = i
+			break
+		}
+	}
+
+	percentFee := amount.Percent(percent)
+	fee = flat + percentFee
+	breakdown["flat_fee"] = flat
+	breakdown["percent_fee"] = percentFee
+	breakdown["base_fee"] = fee
+
+	// Time-based surcharge
+	surcharge := money.Amount(0)
+	if inPeakWindow(config, now) {
+		surcharge = amount.Percent(config.PeakSurcharge)
+	}
+	fee += surcharge
+	breakdown["peak_surcharge"] = surcharge
+
+	// Enforce floor and cap
+	if fee < config.Floor {
+		fee = config.Floor
+	}
+	if config.Cap != nil && fee > *config.Cap {
+		fee = *config.Cap
+	}
+
+	breakdown["total_fee"] = fee
+	return fee, breakdown
+}
+
+// inPeakWindow reports whether now falls in any of the rule's peak windows,
+// read in the rule's timezone. The part of a window that runs past midnight
+// belongs to the day the window started on.
+func inPeakWindow(config models.FeeConfig, now time.Time) bool {
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, window := range config.PeakWindows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			continue
+		}
+
+		day := local.Weekday()
+		switch {
+		case start <= end:
+			if minute < start || minute >= end {
+				continue
+			}
+		case minute >= start:
+		case minute < end:
+			day = (day + 6) % 7
+		default:
+			continue
+		}
+
+		if len(window.Weekdays) == 0 {
+			return true
+		}
+		for _, weekday := range window.Weekdays {
+			if weekday == day {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseClock turns "HH:MM" into minutes past midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
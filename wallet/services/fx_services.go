@@ -0,0 +1,214 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	ledgerServices "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/interfaces"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+var (
+	ErrQuoteNotFound  = errors.New("quote not found or expired")
+	ErrSameCurrency   = errors.New("cannot convert a currency into itself")
+	ErrAmountTooSmall = errors.New("amount is too small to convert")
+)
+
+// FXService converts funds between a user's own wallets.
+type FXService struct {
+	wallet        *WalletService
+	rates         interfaces.RateProvider
+	spreadPercent float64
+	quoteTTL      time.Duration
+}
+
+func NewFXService(wallet *WalletService, rates interfaces.RateProvider, spreadPercent float64, quoteTTL time.Duration) *FXService {
+	return &FXService{
+		wallet:        wallet,
+		rates:         rates,
+		spreadPercent: spreadPercent,
+		quoteTTL:      quoteTTL,
+	}
+}
+
+// Quote prices a conversion and holds it in Redis until quoteTTL runs out.
+// The spread fee is taken in the source currency before converting.
+func (fx *FXService) Quote(userID uuid.UUID, from, to string, amount money.Amount) (*models.FXQuote, error) {
+	if amount <= 0 {
+		return nil, ErrNonPositiveAmount
+	}
+	from, err := money.NormalizeCurrency(from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = money.NormalizeCurrency(to)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, ErrSameCurrency
+	}
+
+	rate, err := fx.rates.Rate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := amount.Percent(fx.spreadPercent)
+	converted := (amount - fee).MulRat(rate)
+	if converted <= 0 {
+		return nil, ErrAmountTooSmall
+	}
+
+	quote := &models.FXQuote{
+		ID:              uuid.NewString(),
+		UserID:          userID,
+		FromCurrency:    from,
+		ToCurrency:      to,
+		Amount:          amount,
+		Rate:            rate.FloatString(6),
+		SpreadPercent:   fx.spreadPercent,
+		Fee:             fee,
+		ConvertedAmount: converted,
+		ExpiresAt:       time.Now().Add(fx.quoteTTL),
+	}
+
+	data, _ := json.Marshal(quote)
+	if err := fx.wallet.redisClient.Set(ctx, fx.quoteKey(quote.ID), data, fx.quoteTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store quote: %v", err)
+	}
+
+	return quote, nil
+}
+
+// Execute carries out a quote exactly as priced. A quote can only be used
+// once and only by the user it was issued to. Converting more than the
+// step-up limit of the source currency also needs a two-factor code.
+func (fx *FXService) Execute(userID uuid.UUID, quoteID string, stepUpCode string) ([]models.Transaction, error) {
+	// Check before taking the quote so a refused user can still use it
+	// once verified.
+	if err := fx.wallet.requireKYC(userID, models.ConvertTransaction); err != nil {
+		return nil, err
+	}
+
+	data, err := fx.wallet.redisClient.Get(ctx, fx.quoteKey(quoteID)).Result()
+	if err == redis.Nil {
+		return nil, ErrQuoteNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var quote models.FXQuote
+	if err := json.Unmarshal([]byte(data), &quote); err != nil {
+		return nil, fmt.Errorf("failed to read quote: %v", err)
+	}
+	if quote.UserID != userID || time.Now().After(quote.ExpiresAt) {
+		return nil, ErrQuoteNotFound
+	}
+	// The spread fee comes out of the amount, so the amount is all it debits.
+	if err := fx.wallet.authorizeDebit(userID, quote.Amount, quote.Amount, quote.FromCurrency, stepUpCode); err != nil {
+		return nil, err
+	}
+
+	// Take the quote. Another request may have taken it since we read it.
+	// If the conversion then fails, release puts it back for another try.
+	taken, err := fx.wallet.redisClient.Del(ctx, fx.quoteKey(quoteID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if taken == 0 {
+		return nil, ErrQuoteNotFound
+	}
+	release := func() {
+		if remaining := time.Until(quote.ExpiresAt); remaining > 0 {
+			fx.wallet.redisClient.Set(ctx, fx.quoteKey(quoteID), data, remaining)
+		}
+	}
+
+	breakdown, _ := json.Marshal(map[string]interface{}{
+		"fx_spread":      quote.Fee,
+		"spread_percent": quote.SpreadPercent,
+		"rate":           quote.Rate,
+		"total_fee":      quote.Fee,
+	})
+
+	debit := models.Transaction{
+		UserID:       userID,
+		Amount:       quote.Amount,
+		Currency:     quote.FromCurrency,
+		Type:         models.ConvertTransaction,
+		Direction:    models.Debit,
+		Status:       models.StatusSuccess,
+		Fee:          quote.Fee,
+		NetAmount:    quote.Amount - quote.Fee,
+		FeeBreakdown: breakdown,
+		QuoteID:      quote.ID,
+	}
+	credit := models.Transaction{
+		UserID:       userID,
+		Amount:       quote.ConvertedAmount,
+		Currency:     quote.ToCurrency,
+		Type:         models.ConvertTransaction,
+		Direction:    models.Credit,
+		Status:       models.StatusSuccess,
+		NetAmount:    quote.ConvertedAmount,
+		FeeBreakdown: breakdown,
+		QuoteID:      quote.ID,
+	}
+
+	err = fx.wallet.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&debit).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&credit).Error; err != nil {
+			return err
+		}
+		if _, err := fx.wallet.adjustBalance(tx, userID, quote.FromCurrency, -quote.Amount); err != nil {
+			return err
+		}
+		if _, err := fx.wallet.adjustBalance(tx, userID, quote.ToCurrency, quote.ConvertedAmount); err != nil {
+			return err
+		}
+		_, err := fx.wallet.ledger.Post(tx, "convert:"+quote.ID, fmt.Sprintf("convert %s to %s at %s", quote.FromCurrency, quote.ToCurrency, quote.Rate), &debit.ID,
+			ledgerServices.WalletLine(userID, quote.FromCurrency, -quote.Amount),
+			ledgerServices.FeeLine(quote.FromCurrency, quote.Fee),
+			ledgerServices.FXLine(quote.FromCurrency, quote.Amount-quote.Fee),
+			ledgerServices.FXLine(quote.ToCurrency, -quote.ConvertedAmount),
+			ledgerServices.WalletLine(userID, quote.ToCurrency, quote.ConvertedAmount),
+		)
+		if err != nil {
+			return err
+		}
+		return fx.wallet.publishTransactions(tx, &debit, &credit)
+	})
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	fx.wallet.invalidateBalance(userID, quote.FromCurrency)
+	fx.wallet.invalidateBalance(userID, quote.ToCurrency)
+	return []models.Transaction{debit, credit}, nil
+}
+
+// Convert quotes and executes in one step for callers that do not need to
+// show the rate first.
+func (fx *FXService) Convert(userID uuid.UUID, from, to string, amount money.Amount, stepUpCode string) ([]models.Transaction, error) {
+	quote, err := fx.Quote(userID, from, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	return fx.Execute(userID, quote.ID, stepUpCode)
+}
+
+func (fx *FXService) quoteKey(quoteID string) string {
+	return fmt.Sprintf("fx:quote:%s", quoteID)
+}
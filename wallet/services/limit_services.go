@@ -0,0 +1,589 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/interfaces"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLimitExceeded     = errors.New("transaction limit exceeded")
+	ErrInvalidTierLimit  = errors.New("invalid tier limit")
+	ErrTierLimitNotFound = errors.New("tier limit not found")
+	// ErrLimitNotConfigured refuses transactions no limit row covers, rather
+	// than letting them through unlimited.
+	ErrLimitNotConfigured = errors.New("no transaction limit is configured")
+	ErrKYCRequired        = errors.New("identity verification required")
+	ErrInvalidKYCRule     = errors.New("invalid verification requirement")
+)
+
+// limitTransactionTypes are the transaction types counted against tier
+// limits.
+var limitTransactionTypes = []models.TransactionType{
+	models.DepositTransaction,
+	models.WithdrawTransaction,
+	models.TransferTransaction,
+}
+
+// kycTransactionTypes are the transaction types a verification level can be
+// required for.
+var kycTransactionTypes = []models.TransactionType{
+	models.DepositTransaction,
+	models.WithdrawTransaction,
+	models.TransferTransaction,
+	models.ConvertTransaction,
+}
+
+// LimitExceededError names the limit a transaction would break and when
+// enough of the window frees up to try again. ResetsAt is nil when waiting
+// will not help, e.g. for the per-transaction maximum.
+type LimitExceededError struct {
+	Limit    string
+	Max      string
+	ResetsAt *time.Time
+}
+
+func (e *LimitExceededError) Error() string {
+	msg := fmt.Sprintf("%v: %s limit of %s", ErrLimitExceeded, e.Limit, e.Max)
+	if e.ResetsAt != nil {
+		msg += fmt.Sprintf(", resets at %s", e.ResetsAt.UTC().Format(time.RFC3339))
+	}
+	return msg
+}
+
+func (e *LimitExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// KYCRequiredError is returned when a user's verification level is too low
+// for a transaction type.
+type KYCRequiredError struct {
+	TransactionType models.TransactionType
+	RequiredLevel   int
+	CurrentLevel    int
+}
+
+func (e *KYCRequiredError) Error() string {
+	return fmt.Sprintf("%v: %s needs verification level %d, you have %d", ErrKYCRequired, e.TransactionType, e.RequiredLevel, e.CurrentLevel)
+}
+
+func (e *KYCRequiredError) Unwrap() error {
+	return ErrKYCRequired
+}
+
+// reserveLimitScript checks a transaction against every rolling window and,
+// if it fits, records it. Entries of the sorted set are "<id>:<minor units>"
+// scored by time in ms.
+//
+// ARGV: now, amount, member, longest window, then per window: length,
+// max amount, max count (-1 for none). Returns {0} on success, or
+// {window index (1-based), 1 for amount / 2 for count, reset time in ms or -1}.
+var reserveLimitScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local amount = tonumber(ARGV[2])
+local longest = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - longest)
+local entries = redis.call('ZRANGEBYSCORE', key, now - longest, '+inf', 'WITHSCORES')
+
+for w = 0, (#ARGV - 4) / 3 - 1 do
+	local window = tonumber(ARGV[5 + w * 3])
+	local maxAmount = tonumber(ARGV[6 + w * 3])
+	local maxCount = tonumber(ARGV[7 + w * 3])
+	local since = now - window
+	local total, inWindow = 0, {}
+	for i = 1, #entries, 2 do
+		local score = tonumber(entries[i + 1])
+		if score > since then
+			local value = tonumber(string.match(entries[i], ':(%d+)$'))
+			total = total + value
+			table.insert(inWindow, {score, value})
+		end
+	end
+
+	if maxCount >= 0 and #inWindow + 1 > maxCount then
+		local oldest = inWindow[#inWindow - maxCount + 1]
+		if oldest == nil then
+			return {w + 1, 2, -1}
+		end
+		return {w + 1, 2, oldest[1] + window}
+	end
+	if maxAmount >= 0 and total + amount > maxAmount then
+		local excess = total + amount - maxAmount
+		for _, entry in ipairs(inWindow) do
+			excess = excess - entry[2]
+			if excess <= 0 then
+				return {w + 1, 1, entry[1] + window}
+			end
+		end
+		return {w + 1, 1, -1}
+	end
+end
+
+redis.call('ZADD', key, now, ARGV[3])
+redis.call('PEXPIRE', key, longest)
+return {0}
+`)
+
+// LimitService enforces per-tier transaction limits. Caps are stored in
+// tier_limits; what each user has moved in the rolling windows is tracked in
+// a Redis sorted set per user, transaction type and currency.
+//
+// When kyc is set, caps also depend on the user's verification level and
+// kyc_requirements decides which transaction types they may make at all.
+type LimitService struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	kyc         interfaces.KYCChecker
+}
+
+func NewLimitService(db *gorm.DB, redisClient *redis.Client, kyc interfaces.KYCChecker) *LimitService {
+	return &LimitService{
+		db:          db,
+		redisClient: redisClient,
+		kyc:         kyc,
+	}
+}
+
+// CheckKYC returns the user's verification level, or a *KYCRequiredError if
+// it is below what txnType requires.
+func (ls *LimitService) CheckKYC(userID uuid.UUID, txnType models.TransactionType) (int, error) {
+	if ls.kyc == nil {
+		return 0, nil
+	}
+	level, err := ls.kyc.Level(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load verification level: %v", err)
+	}
+
+	var requirement models.KYCRequirement
+	err = ls.db.First(&requirement, "transaction_type = ?", txnType).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return level, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load verification requirements: %v", err)
+	}
+	if level < requirement.MinLevel {
+		return level, &KYCRequiredError{TransactionType: txnType, RequiredLevel: requirement.MinLevel, CurrentLevel: level}
+	}
+	return level, nil
+}
+
+// Reserve counts a transaction against the user's limits, or returns a
+// *LimitExceededError naming the limit it would break, or a
+// *KYCRequiredError if the user may not make this type of transaction. The
+// caller must call release if the transaction does not go through.
+func (ls *LimitService) Reserve(userID uuid.UUID, userTier string, txnType models.TransactionType, amount money.Amount, currency string) (func(), error) {
+	noop := func() {}
+	level, err := ls.CheckKYC(userID, txnType)
+	if err != nil {
+		return noop, err
+	}
+	limit, ok, err := ls.lookup(models.NormalizeTier(userTier), txnType, currency, level)
+	if err != nil {
+		return noop, fmt.Errorf("failed to load transaction limits: %v", err)
+	}
+	if !ok {
+		return noop, limitNotConfigured(userTier, txnType, currency)
+	}
+
+	if limit.MaxPerTransaction != nil && amount > *limit.MaxPerTransaction {
+		return noop, &LimitExceededError{Limit: "per_transaction", Max: limit.MaxPerTransaction.String() + " " + currency}
+	}
+
+	member := uuid.NewString() + ":" + strconv.FormatInt(int64(amount), 10)
+	args := []interface{}{time.Now().UnixMilli(), int64(amount), member, models.MonthlyWindow.Duration().Milliseconds()}
+	for _, window := range models.LimitWindows {
+		maxAmount, maxCount := limit.Window(window)
+		args = append(args, window.Duration().Milliseconds(), optionalAmount(maxAmount), optionalCount(maxCount))
+	}
+
+	key := ls.usageKey(userID, txnType, currency)
+	result, err := reserveLimitScript.Run(ctx, ls.redisClient, []string{key}, args...).Int64Slice()
+	if err != nil {
+		return noop, fmt.Errorf("failed to check transaction limits: %v", err)
+	}
+	if result[0] != 0 {
+		window := models.LimitWindows[result[0]-1]
+		maxAmount, maxCount := limit.Window(window)
+		exceeded := &LimitExceededError{}
+		if result[1] == 2 {
+			exceeded.Limit = string(window) + "_count"
+			exceeded.Max = strconv.FormatInt(*maxCount, 10) + " transactions"
+		} else {
+			exceeded.Limit = string(window) + "_amount"
+			exceeded.Max = maxAmount.String() + " " + currency
+		}
+		if result[2] >= 0 {
+			resetsAt := time.UnixMilli(result[2])
+			exceeded.ResetsAt = &resetsAt
+		}
+		return noop, exceeded
+	}
+
+	return func() {
+		if err := ls.redisClient.ZRem(ctx, key, member).Err(); err != nil {
+			log.Printf("failed to release limit reservation for %s: %v", userID, err)
+		}
+	}, nil
+}
+
+// Usages reports Usage for every transaction type that has limits.
+func (ls *LimitService) Usages(userID uuid.UUID, userTier string, currency string) ([]models.LimitUsage, error) {
+	usages := make([]models.LimitUsage, 0, len(limitTransactionTypes))
+	for _, txnType := range limitTransactionTypes {
+		usage, err := ls.Usage(userID, userTier, txnType, currency)
+		// The user cannot make these at all, so there is no usage to show.
+		if errors.Is(err, ErrLimitNotConfigured) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, *usage)
+	}
+	return usages, nil
+}
+
+// Usage reports how much of each limit the user has left for txnType.
+func (ls *LimitService) Usage(userID uuid.UUID, userTier string, txnType models.TransactionType, currency string) (*models.LimitUsage, error) {
+	tier := models.NormalizeTier(userTier)
+	level := 0
+	if ls.kyc != nil {
+		var err error
+		if level, err = ls.kyc.Level(userID); err != nil {
+			return nil, fmt.Errorf("failed to load verification level: %v", err)
+		}
+	}
+	limit, ok, err := ls.lookup(tier, txnType, currency, level)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, limitNotConfigured(userTier, txnType, currency)
+	}
+
+	now := time.Now()
+	since := now.Add(-models.MonthlyWindow.Duration())
+	entries, err := ls.redisClient.ZRangeByScoreWithScores(ctx, ls.usageKey(userID, txnType, currency), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction limits: %v", err)
+	}
+
+	usage := &models.LimitUsage{
+		TransactionType:   txnType,
+		Currency:          currency,
+		Tier:              tier,
+		KYCLevel:          level,
+		MaxPerTransaction: limit.MaxPerTransaction,
+	}
+	for _, window := range models.LimitWindows {
+		maxAmount, maxCount := limit.Window(window)
+		w := models.WindowUsage{Window: window, MaxAmount: maxAmount, MaxCount: maxCount}
+		windowStart := now.Add(-window.Duration()).UnixMilli()
+		for _, entry := range entries {
+			if int64(entry.Score) <= windowStart {
+				continue
+			}
+			if w.ResetsAt == nil {
+				resetsAt := time.UnixMilli(int64(entry.Score)).Add(window.Duration())
+				w.ResetsAt = &resetsAt
+			}
+			w.UsedAmount += entryAmount(entry.Member)
+			w.UsedCount++
+		}
+		if maxAmount != nil {
+			remaining := *maxAmount - w.UsedAmount
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.RemainingAmount = &remaining
+		}
+		if maxCount != nil {
+			remaining := *maxCount - w.UsedCount
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.RemainingCount = &remaining
+		}
+		usage.Windows = append(usage.Windows, w)
+	}
+	return usage, nil
+}
+
+// ListLimits returns every configured limit.
+func (ls *LimitService) ListLimits() ([]models.TierLimit, error) {
+	var limits []models.TierLimit
+	err := ls.db.Order("tier, transaction_type, currency, kyc_level").Find(&limits).Error
+	return limits, err
+}
+
+// SetLimit creates or replaces the limit for the tier, type, currency and
+// verification level.
+func (ls *LimitService) SetLimit(limit models.TierLimit) (*models.TierLimit, error) {
+	if err := ValidateTierLimit(&limit); err != nil {
+		return nil, err
+	}
+
+	err := ls.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tier"}, {Name: "transaction_type"}, {Name: "currency"}, {Name: "kyc_level"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_per_transaction", "daily_amount", "daily_count", "weekly_amount", "weekly_count", "monthly_amount", "monthly_count", "updated_at"}),
+	}).Create(&limit).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var stored models.TierLimit
+	err = ls.db.First(&stored, "tier = ? AND transaction_type = ? AND currency = ? AND kyc_level = ?",
+		limit.Tier, limit.TransactionType, limit.Currency, limit.KYCLevel).Error
+	return &stored, err
+}
+
+// DeleteLimit removes a limit. Users it applied to fall back to the row for
+// a lower verification level; if there is none, they cannot make that
+// transaction until a limit is set again.
+func (ls *LimitService) DeleteLimit(id uint) error {
+	result := ls.db.Delete(&models.TierLimit{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTierLimitNotFound
+	}
+	return nil
+}
+
+// ListKYCRequirements returns the verification level each transaction type
+// needs.
+func (ls *LimitService) ListKYCRequirements() ([]models.KYCRequirement, error) {
+	var requirements []models.KYCRequirement
+	err := ls.db.Order("transaction_type").Find(&requirements).Error
+	return requirements, err
+}
+
+// SetKYCRequirement sets the verification level a transaction type needs.
+// A level of zero lets unverified users make it.
+func (ls *LimitService) SetKYCRequirement(requirement models.KYCRequirement) (*models.KYCRequirement, error) {
+	requirement.TransactionType = models.TransactionType(strings.ToLower(string(requirement.TransactionType)))
+	if !containsType(kycTransactionTypes, requirement.TransactionType) {
+		return nil, fmt.Errorf("%w: unknown transaction type %q", ErrInvalidKYCRule, requirement.TransactionType)
+	}
+	if requirement.MinLevel < 0 {
+		return nil, fmt.Errorf("%w: min_level cannot be negative", ErrInvalidKYCRule)
+	}
+
+	err := ls.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "transaction_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min_level", "updated_at"}),
+	}).Create(&requirement).Error
+	if err != nil {
+		return nil, err
+	}
+	return &requirement, nil
+}
+
+func (ls *LimitService) seedKYCRequirements() error {
+	var count int64
+	if err := ls.db.Model(&models.KYCRequirement{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// Money may come in and move between the user's own currencies before
+	// they are verified; it may only leave once their identity is known.
+	defaults := []models.KYCRequirement{
+		{TransactionType: models.DepositTransaction, MinLevel: 0},
+		{TransactionType: models.ConvertTransaction, MinLevel: 0},
+		{TransactionType: models.WithdrawTransaction, MinLevel: 1},
+		{TransactionType: models.TransferTransaction, MinLevel: 1},
+	}
+	log.Printf("Seeding %d verification requirements", len(defaults))
+	return ls.db.Create(&defaults).Error
+}
+
+// SeedDefaults writes the standard limits for every limited transaction
+// type and supported currency that has none, and the verification each
+// transaction type needs. Each currency gets the same figures in its own
+// units. Users verified to level 1 or above get five times the unverified
+// amounts. Scopes that already have a limit, at any level, are left alone.
+func (ls *LimitService) SeedDefaults() error {
+	if err := ls.seedKYCRequirements(); err != nil {
+		return err
+	}
+
+	var existing []models.TierLimit
+	if err := ls.db.Select("tier", "transaction_type", "currency").Find(&existing).Error; err != nil {
+		return err
+	}
+	configured := make(map[string]bool, len(existing))
+	scope := func(l models.TierLimit) string {
+		return fmt.Sprintf("%s:%s:%s", l.Tier, l.TransactionType, l.Currency)
+	}
+	for _, l := range existing {
+		configured[scope(l)] = true
+	}
+
+	amount := func(s string) *money.Amount { a := money.MustParse(s); return &a }
+	count64 := func(n int64) *int64 { return &n }
+	tiers := []models.TierLimit{
+		{Tier: models.BasicTier, MaxPerTransaction: amount("1000.00"),
+			DailyAmount: amount("2000.00"), DailyCount: count64(10),
+			WeeklyAmount: amount("5000.00"), WeeklyCount: count64(30),
+			MonthlyAmount: amount("10000.00"), MonthlyCount: count64(100)},
+		{Tier: models.PremiumTier, MaxPerTransaction: amount("10000.00"),
+			DailyAmount: amount("20000.00"), DailyCount: count64(50),
+			WeeklyAmount: amount("50000.00"), WeeklyCount: count64(200),
+			MonthlyAmount: amount("100000.00"), MonthlyCount: count64(500)},
+		{Tier: models.EnterpriseTier, MaxPerTransaction: amount("100000.00"),
+			DailyAmount:   amount("250000.00"),
+			WeeklyAmount:  amount("1000000.00"),
+			MonthlyAmount: amount("2500000.00")},
+	}
+
+	currencies := money.SupportedCurrencies()
+	sort.Strings(currencies)
+
+	var defaults []models.TierLimit
+	for _, txnType := range limitTransactionTypes {
+		for _, currency := range currencies {
+			for _, limit := range tiers {
+				limit.TransactionType = txnType
+				limit.Currency = currency
+				if configured[scope(limit)] {
+					continue
+				}
+				defaults = append(defaults, limit)
+
+				verified := limit
+				verified.KYCLevel = 1
+				verified.MaxPerTransaction = scaleAmount(limit.MaxPerTransaction, 5)
+				verified.DailyAmount = scaleAmount(limit.DailyAmount, 5)
+				verified.WeeklyAmount = scaleAmount(limit.WeeklyAmount, 5)
+				verified.MonthlyAmount = scaleAmount(limit.MonthlyAmount, 5)
+				defaults = append(defaults, verified)
+			}
+		}
+	}
+	if len(defaults) == 0 {
+		return nil
+	}
+
+	log.Printf("Seeding %d default transaction limits", len(defaults))
+	return ls.db.Create(&defaults).Error
+}
+
+// ValidateTierLimit normalizes the key fields of a limit and checks its caps
+// are positive and wider windows are not tighter than narrower ones.
+func ValidateTierLimit(limit *models.TierLimit) error {
+	limit.Tier = models.UserTier(strings.ToLower(strings.TrimSpace(string(limit.Tier))))
+	if !limit.Tier.Valid() {
+		return fmt.Errorf("%w: unknown tier %q", ErrInvalidTierLimit, limit.Tier)
+	}
+	limit.TransactionType = models.TransactionType(strings.ToLower(string(limit.TransactionType)))
+	if !containsType(limitTransactionTypes, limit.TransactionType) {
+		return fmt.Errorf("%w: unknown transaction type %q", ErrInvalidTierLimit, limit.TransactionType)
+	}
+	currency, err := money.NormalizeCurrency(limit.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTierLimit, err)
+	}
+	limit.Currency = currency
+	if limit.KYCLevel < 0 {
+		return fmt.Errorf("%w: kyc_level cannot be negative", ErrInvalidTierLimit)
+	}
+
+	if limit.MaxPerTransaction != nil && *limit.MaxPerTransaction <= 0 {
+		return fmt.Errorf("%w: max_per_transaction must be positive", ErrInvalidTierLimit)
+	}
+	var prevAmount *money.Amount
+	var prevCount *int64
+	for _, window := range models.LimitWindows {
+		maxAmount, maxCount := limit.Window(window)
+		if maxAmount != nil && *maxAmount <= 0 {
+			return fmt.Errorf("%w: %s_amount must be positive", ErrInvalidTierLimit, window)
+		}
+		if maxCount != nil && *maxCount <= 0 {
+			return fmt.Errorf("%w: %s_count must be positive", ErrInvalidTierLimit, window)
+		}
+		if maxAmount != nil && prevAmount != nil && *maxAmount < *prevAmount {
+			return fmt.Errorf("%w: %s_amount is below a shorter window's", ErrInvalidTierLimit, window)
+		}
+		if maxCount != nil && prevCount != nil && *maxCount < *prevCount {
+			return fmt.Errorf("%w: %s_count is below a shorter window's", ErrInvalidTierLimit, window)
+		}
+		if maxAmount != nil {
+			prevAmount = maxAmount
+		}
+		if maxCount != nil {
+			prevCount = maxCount
+		}
+	}
+	return nil
+}
+
+// lookup finds the limit for the highest verification level at or below
+// level.
+func (ls *LimitService) lookup(tier models.UserTier, txnType models.TransactionType, currency string, level int) (models.TierLimit, bool, error) {
+	var limit models.TierLimit
+	err := ls.db.Where("tier = ? AND transaction_type = ? AND currency = ? AND kyc_level <= ?", tier, txnType, currency, level).
+		Order("kyc_level DESC").First(&limit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return limit, false, nil
+	}
+	return limit, err == nil, err
+}
+
+func limitNotConfigured(userTier string, txnType models.TransactionType, currency string) error {
+	return fmt.Errorf("%w: %s %s for the %s tier", ErrLimitNotConfigured, currency, txnType, models.NormalizeTier(userTier))
+}
+
+func (ls *LimitService) usageKey(userID uuid.UUID, txnType models.TransactionType, currency string) string {
+	return fmt.Sprintf("limits:%s:%s:%s", userID, txnType, currency)
+}
+
+func entryAmount(member interface{}) money.Amount {
+	s, _ := member.(string)
+	_, minor, _ := strings.Cut(s, ":")
+	value, _ := strconv.ParseInt(minor, 10, 64)
+	return money.FromMinor(value)
+}
+
+func scaleAmount(a *money.Amount, factor int64) *money.Amount {
+	if a == nil {
+		return nil
+	}
+	scaled := *a * money.Amount(factor)
+	return &scaled
+}
+
+func optionalAmount(a *money.Amount) int64 {
+	if a == nil {
+		return -1
+	}
+	return int64(*a)
+}
+
+func optionalCount(n *int64) int64 {
+	if n == nil {
+		return -1
+	}
+	return *n
+}
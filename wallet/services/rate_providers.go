@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// StaticRateProvider serves a fixed table of rates keyed "FROM/TO". A pair
+// that is only listed the other way round is served as its inverse.
+type StaticRateProvider struct {
+	rates map[string]*big.Rat
+}
+
+func NewStaticRateProvider(rates map[string]string) (*StaticRateProvider, error) {
+	parsed := make(map[string]*big.Rat, len(rates))
+	for pair, value := range rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", value, pair)
+		}
+		parsed[strings.ToUpper(pair)] = rate
+	}
+	return &StaticRateProvider{rates: parsed}, nil
+}
+
+// NewFileRateProvider loads a JSON object of "FROM/TO": "rate" pairs.
+func NewFileRateProvider(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %v", err)
+	}
+
+	var rates map[string]string
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file: %v", err)
+	}
+	return NewStaticRateProvider(rates)
+}
+
+func (p *StaticRateProvider) Rate(_ context.Context, from, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	if rate, ok := p.rates[from+"/"+to]; ok {
+		return new(big.Rat).Set(rate), nil
+	}
+	if rate, ok := p.rates[to+"/"+from]; ok {
+		return new(big.Rat).Inv(rate), nil
+	}
+	return nil, ErrRateUnavailable
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"log"
@@ -9,27 +10,38 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	userModel "github.com/nazrawigedion123/wallet-backend/auth/models"
+	"github.com/nazrawigedion123/wallet-backend/tier"
 	"github.com/nazrawigedion123/wallet-backend/wallet/models"
-	userModel	"github.com/nazrawigedion123/wallet-backend/auth/models"
 )
 
-func (ws *WalletService) GenerateUsers(opts models.SimulationOptions) {
-	rateLimiter := time.Tick(100 * time.Microsecond) // simple rate limit
-	tiers := []string{"basic", "premium", "enterprise"}
+// GenerateUsers creates opts.Count fake users, stopping early if ctx is
+// cancelled. Users created so far are still written to the CSV.
+func (ws *WalletService) GenerateUsers(ctx context.Context, opts models.SimulationOptions) {
+	rateLimiter := time.NewTicker(100 * time.Microsecond) // simple rate limit
+	defer rateLimiter.Stop()
 
 	var records [][]string
+	created := 0
+generate:
 	for i := 0; i < opts.Count; i++ {
-		<-rateLimiter
+		select {
+		case <-ctx.Done():
+			log.Printf("⚠️  User simulation stopped after %d of %d users", created, opts.Count)
+			break generate
+		case <-rateLimiter.C:
+		}
 		user := userModel.User{
 			ID:    uuid.New(),
 			Email: fmt.Sprintf("user%d@example.com", i),
-			Tier:  tiers[rand.Intn(len(tiers))],
+			Tier:  tier.All[rand.Intn(len(tier.All))],
 		}
 
 		ws.db.Create(&user)
+		created++
 
 		if opts.OutputToCSV {
-			records = append(records, []string{user.ID.String(), user.Email, user.Tier})
+			records = append(records, []string{user.ID.String(), user.Email, string(user.Tier)})
 		}
 	}
 
@@ -41,5 +53,5 @@ func (ws *WalletService) GenerateUsers(opts models.SimulationOptions) {
 		file.Close()
 	}
 
-	log.Printf("✅ Finished simulating %d users", opts.Count)
+	log.Printf("✅ Finished simulating %d users", created)
 }
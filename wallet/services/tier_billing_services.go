@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	authInterfaces "github.com/nazrawigedion123/wallet-backend/auth/interfaces"
+	ledgerServices "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/tier"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+	"gorm.io/gorm"
+)
+
+// TierBilling charges tier upgrades to the user's USD wallet. An upgrade
+// costs the difference between the two tiers' prices. A tier without a
+// price cannot be bought; a price of zero makes it free.
+type TierBilling struct {
+	ws     *WalletService
+	prices map[tier.Tier]money.Amount
+}
+
+var _ authInterfaces.TierBilling = (*TierBilling)(nil)
+
+func NewTierBilling(ws *WalletService, prices map[tier.Tier]money.Amount) *TierBilling {
+	return &TierBilling{
+		ws:     ws,
+		prices: prices,
+	}
+}
+
+// Price returns what moving from one tier to another costs.
+func (b *TierBilling) Price(from, to tier.Tier) money.Amount {
+	if price := b.prices[to] - b.prices[from]; price > 0 {
+		return price
+	}
+	return 0
+}
+
+func (b *TierBilling) ChargeUpgrade(userID uuid.UUID, from, to tier.Tier, apply func(tx *gorm.DB, transactionID *uint) error) error {
+	if _, ok := b.prices[to]; !ok {
+		return fmt.Errorf("%w: %s", authInterfaces.ErrTierNotForSale, to)
+	}
+	price := b.Price(from, to)
+	if price == 0 {
+		return b.ws.db.Transaction(func(tx *gorm.DB) error { return apply(tx, nil) })
+	}
+
+	currency := money.DefaultCurrency
+	details, _ := json.Marshal(map[string]interface{}{"from_tier": from, "to_tier": to})
+	txn := models.Transaction{
+		UserID:       userID,
+		Amount:       price,
+		Currency:     currency,
+		Type:         models.TierUpgradeTransaction,
+		Direction:    models.Debit,
+		Status:       models.StatusSuccess,
+		NetAmount:    price,
+		FeeBreakdown: details,
+	}
+
+	err := b.ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&txn).Error; err != nil {
+			return err
+		}
+		if _, err := b.ws.adjustBalance(tx, userID, currency, -price); err != nil {
+			if errors.Is(err, ErrInsufficientBalance) {
+				return fmt.Errorf("%w: upgrading to %s costs %s %s", authInterfaces.ErrPaymentDeclined, to, price, currency)
+			}
+			return err
+		}
+		_, err := b.ws.ledger.Post(tx, string(models.TierUpgradeTransaction), fmt.Sprintf("upgrade to %s tier", to), &txn.ID,
+			ledgerServices.WalletLine(userID, currency, -price),
+			ledgerServices.FeeLine(currency, price),
+		)
+		if err != nil {
+			return err
+		}
+		if err := b.ws.publishTransactions(tx, &txn); err != nil {
+			return err
+		}
+		return apply(tx, &txn.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.ws.invalidateBalance(userID, currency)
+	return nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	userModel "github.com/nazrawigedion123/wallet-backend/auth/models"
+	ledgerServices "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+)
+
+var (
+	ErrRecipientNotFound = errors.New("recipient not found")
+	ErrSelfTransfer      = errors.New("cannot transfer to yourself")
+)
+
+// ResolveRecipient finds a user by id or, failing that, by email.
+func (ws *WalletService) ResolveRecipient(recipient string) (uuid.UUID, error) {
+	recipient = strings.TrimSpace(recipient)
+
+	var user userModel.User
+	query := ws.db.Select("id")
+	if id, err := uuid.Parse(recipient); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("LOWER(email) = LOWER(?)", recipient)
+	}
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, ErrRecipientNotFound
+		}
+		return uuid.Nil, err
+	}
+
+	return user.ID, nil
+}
+
+// Transfer moves amount from the sender's wallet to the recipient's wallet in
+// the same currency. The sender pays the tier fee, or the fee locked in by
+// quoteToken, on top of amount. Amounts above the step-up limit also need a
+// two-factor code. Both legs are written in one database transaction and
+// share a transfer id.
+func (ws *WalletService) Transfer(senderID uuid.UUID, senderTier string, recipient string, amount money.Amount, currency string, quoteToken string, stepUpCode string) ([]models.Transaction, error) {
+	if amount <= 0 {
+		return nil, ErrNonPositiveAmount
+	}
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientID, err := ws.ResolveRecipient(recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipientID == senderID {
+		return nil, ErrSelfTransfer
+	}
+
+	releaseLimits, err := ws.reserveLimits(senderID, senderTier, models.TransferTransaction, amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	priced, release, err := ws.fees.Price(senderID, senderTier, models.TransferTransaction, amount, currency, quoteToken)
+	if err != nil {
+		releaseLimits()
+		return nil, err
+	}
+	fee := priced.Fee
+	if err := ws.authorizeDebit(senderID, amount, amount+fee, currency, stepUpCode); err != nil {
+		release()
+		releaseLimits()
+		return nil, err
+	}
+	transferID := uuid.New()
+
+	debit := models.Transaction{
+		UserID:         senderID,
+		Amount:         amount,
+		Currency:       currency,
+		Type:           models.TransferTransaction,
+		Direction:      models.Debit,
+		Status:         models.StatusSuccess,
+		Fee:            fee,
+		NetAmount:      amount + fee,
+		FeeBreakdown:   priced.BreakdownJSON(),
+		FeeConfigID:    priced.ConfigID,
+		TransferID:     &transferID,
+		CounterpartyID: &recipientID,
+	}
+	credit := models.Transaction{
+		UserID:         recipientID,
+		Amount:         amount,
+		Currency:       currency,
+		Type:           models.TransferTransaction,
+		Direction:      models.Credit,
+		Status:         models.StatusSuccess,
+		NetAmount:      amount,
+		FeeBreakdown:   []byte("{}"),
+		TransferID:     &transferID,
+		CounterpartyID: &senderID,
+	}
+
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&debit).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&credit).Error; err != nil {
+			return err
+		}
+
+		// Lock both wallets in a fixed order so two users paying each other
+		// at the same time cannot deadlock.
+		legs := []struct {
+			userID uuid.UUID
+			delta  money.Amount
+		}{
+			{senderID, -(amount + fee)},
+			{recipientID, amount},
+		}
+		if recipientID.String() < senderID.String() {
+			legs[0], legs[1] = legs[1], legs[0]
+		}
+		for _, leg := range legs {
+			if _, err := ws.adjustBalance(tx, leg.userID, currency, leg.delta); err != nil {
+				return err
+			}
+		}
+
+		lines := []ledgerServices.Line{
+			ledgerServices.WalletLine(senderID, currency, -(amount + fee)),
+			ledgerServices.WalletLine(recipientID, currency, amount),
+		}
+		if fee != 0 {
+			lines = append(lines, ledgerServices.FeeLine(currency, fee))
+		}
+		if _, err := ws.ledger.Post(tx, "transfer:"+transferID.String(), "peer-to-peer transfer", &debit.ID, lines...); err != nil {
+			return err
+		}
+		return ws.publishTransactions(tx, &debit, &credit)
+	})
+	if err != nil {
+		release()
+		releaseLimits()
+		return nil, err
+	}
+
+	ws.invalidateBalance(senderID, currency)
+	ws.invalidateBalance(recipientID, currency)
+	return []models.Transaction{debit, credit}, nil
+}
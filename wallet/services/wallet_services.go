@@ -2,13 +2,18 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	ledgerModels "github.com/nazrawigedion123/wallet-backend/ledger/models"
+	ledgerServices "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/outbox"
+	"github.com/nazrawigedion123/wallet-backend/wallet/interfaces"
 	"github.com/nazrawigedion123/wallet-backend/wallet/models"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -17,151 +22,412 @@ import (
 
 type WalletService struct {
 	redisClient *redis.Client
-	dbWriter    chan models.Transaction
 	db          *gorm.DB
+	ledger      *ledgerServices.LedgerService
+	fees        *FeeService
+	limits      *LimitService
+	stepUp      interfaces.StepUpVerifier
+	// stepUpLimits is the largest withdrawal per currency allowed without a
+	// second factor. Currencies not listed never need one.
+	stepUpLimits map[string]money.Amount
 }
 
-var ctx = context.Background()
+// BalanceDiscrepancy is a wallet whose stored balance differs from the sum of
+// its ledger postings.
+type BalanceDiscrepancy struct {
+	UserID        uuid.UUID    `json:"user_id"`
+	Currency      string       `json:"currency"`
+	WalletBalance money.Amount `json:"wallet_balance"`
+	LedgerBalance money.Amount `json:"ledger_balance"`
+}
 
-func NewWalletService(db *gorm.DB, redisClient *redis.Client) *WalletService {
-	service := &WalletService{
-		db:          db,
-		redisClient: redisClient,
+var ctx = context.Background()
 
-		dbWriter: make(chan models.Transaction, 100), // Buffered to avoid blocking
-	}
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrNonPositiveAmount   = errors.New("amount must be greater than zero")
+	ErrWalletNotFound      = errors.New("no wallet in this currency")
+	ErrFeeExceedsAmount    = errors.New("fee is larger than the amount")
+)
 
-	// Start a goroutine to consume the channel
-	go func() {
-		for txn := range service.dbWriter {
+var (
+	ErrStepUpRequired    = errors.New("two-factor code required for this transaction")
+	ErrStepUpUnavailable = errors.New("enable two-factor authentication to make this transaction")
+	ErrStepUpFailed      = errors.New("two-factor verification failed")
+)
 
-			if err := service.db.Create(&txn).Error; err != nil {
-				log.Printf("failed to save transaction: %v", err)
-			} else {
-				fmt.Println("Transaction saved:", txn.ID)
+// balanceCacheTTL bounds how long a balance read back into Redis can live.
+const balanceCacheTTL = time.Minute
+
+func NewWalletService(db *gorm.DB, redisClient *redis.Client, ledger *ledgerServices.LedgerService, fees *FeeService, limits *LimitService, stepUp interfaces.StepUpVerifier, stepUpLimits map[string]money.Amount) *WalletService {
+	return &WalletService{
+		db:           db,
+		redisClient:  redisClient,
+		ledger:       ledger,
+		fees:         fees,
+		limits:       limits,
+		stepUp:       stepUp,
+		stepUpLimits: stepUpLimits,
+	}
+}
 
-				// Now preload the user if needed
-				if err := service.db.Preload("User").First(&txn, txn.ID).Error; err != nil {
-					log.Printf("failed to preload user: %v", err)
-				} else {
-					fmt.Printf("User loaded: %v\n", txn.User)
-				}
-			}
+func (ws *WalletService) GetBalance(userID uuid.UUID, currency string) (money.Money, error) {
+	val, err := ws.redisClient.Get(ctx, ws.balanceKey(userID, currency)).Result()
+	if err == nil {
+		// Values cached before balances were exact fail to parse and are reloaded.
+		if balance, parseErr := money.Parse(val); parseErr == nil {
+			return money.Money{Amount: balance, Currency: currency}, nil
 		}
-	}()
+	} else if err != redis.Nil {
+		return money.Money{}, err
+	}
 
-	return service
+	// Redis miss: fallback to DB
+	var wb models.WalletBalance
+	dbErr := ws.db.First(&wb, "user_id = ? AND currency = ?", userID, currency).Error
+	if errors.Is(dbErr, gorm.ErrRecordNotFound) {
+		return money.Money{}, ErrWalletNotFound
+	}
+	if dbErr != nil {
+		return money.Money{}, dbErr
+	}
+	// Optionally repopulate Redis
+	_ = ws.redisClient.Set(ctx, ws.balanceKey(userID, currency), wb.Balance.String(), balanceCacheTTL).Err()
+	return money.Money{Amount: wb.Balance, Currency: currency}, nil
 }
 
-func (ws *WalletService) GetBalance(userID uuid.UUID) (float64, error) {
-	val, err := ws.redisClient.Get(ctx, ws.balanceKey(userID)).Result()
-	if err == redis.Nil {
-		// Redis miss: fallback to DB
-		var wb models.WalletBalance
-		if dbErr := ws.db.First(&wb, "user_id = ?", userID).Error; dbErr != nil {
-			return 0.0, dbErr
-		}
-		// Optionally repopulate Redis
-		_ = ws.redisClient.Set(ctx, ws.balanceKey(userID), fmt.Sprintf("%f", wb.Balance), 0).Err()
-		return wb.Balance, nil
-	} else if err != nil {
-		return 0.0, err
+// GetBalances returns every wallet the user holds, one per currency.
+func (ws *WalletService) GetBalances(userID uuid.UUID) ([]money.Money, error) {
+	var wallets []models.WalletBalance
+	if err := ws.db.Where("user_id = ?", userID).Order("currency").Find(&wallets).Error; err != nil {
+		return nil, err
 	}
 
-	var balance float64
-	err = json.Unmarshal([]byte(val), &balance)
-	return balance, err
+	balances := make([]money.Money, 0, len(wallets))
+	for _, wb := range wallets {
+		balances = append(balances, money.Money{Amount: wb.Balance, Currency: wb.Currency})
+	}
+	return balances, nil
 }
 
-func (ws *WalletService) Deposit(userID uuid.UUID, userTier string, amount float64) (*models.Transaction, error) {
-	fmt.Println("userid: ", userID)
+func (ws *WalletService) Deposit(userID uuid.UUID, userTier string, amount money.Amount, currency string, quoteToken string) (*models.Transaction, error) {
 	if amount <= 0 {
-		return nil, errors.New("amount must be greater than zero")
+		return nil, ErrNonPositiveAmount
+	}
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
 	}
 
-	balance, _ := ws.GetBalance(userID)
-	newBalance := balance + amount
-
-	err := ws.setBalance(userID, newBalance)
+	releaseLimits, err := ws.reserveLimits(userID, userTier, models.DepositTransaction, amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	fee, release, err := ws.fees.Price(userID, userTier, models.DepositTransaction, amount, currency, quoteToken)
 	if err != nil {
+		releaseLimits()
 		return nil, err
 	}
+	// The fee comes out of the deposit, so the wallet is credited the rest.
+	if fee.Fee > amount {
+		release()
+		releaseLimits()
+		return nil, fmt.Errorf("%w: fee %s on a deposit of %s %s", ErrFeeExceedsAmount, fee.Fee, amount, currency)
+	}
 
-	txn := ws.createTransaction(userID, userTier, amount, models.DepositTransaction)
-	ws.dbWriter <- txn
+	txn := ws.createTransaction(userID, amount, currency, models.DepositTransaction, fee)
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&txn).Error; err != nil {
+			return err
+		}
+		if _, err := ws.adjustBalance(tx, userID, currency, txn.NetAmount); err != nil {
+			return err
+		}
+		lines := []ledgerServices.Line{
+			ledgerServices.WalletLine(userID, currency, txn.NetAmount),
+			ledgerServices.ClearingLine(currency, -amount),
+		}
+		if fee.Fee != 0 {
+			lines = append(lines, ledgerServices.FeeLine(currency, fee.Fee))
+		}
+		_, err := ws.ledger.Post(tx, string(models.DepositTransaction), "wallet deposit", &txn.ID, lines...)
+		if err != nil {
+			return err
+		}
+		return ws.publishTransactions(tx, &txn)
+	})
+	if err != nil {
+		release()
+		releaseLimits()
+		return nil, err
+	}
 
+	ws.invalidateBalance(userID, currency)
 	return &txn, nil
 }
 
-func (ws *WalletService) Withdraw(userID uuid.UUID, userTier string, amount float64) (*models.Transaction, error) {
+// Withdraw takes money out of the user's wallet. Amounts above the step-up
+// limit for the currency also need a two-factor code.
+func (ws *WalletService) Withdraw(userID uuid.UUID, userTier string, amount money.Amount, currency string, quoteToken string, stepUpCode string) (*models.Transaction, error) {
 	if amount <= 0 {
-		return nil, errors.New("amount must be greater than zero")
+		return nil, ErrNonPositiveAmount
 	}
-
-	balance, _ := ws.GetBalance(userID)
-	if balance < amount {
-		return nil, errors.New("insufficient balance")
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
 	}
 
-	newBalance := balance - amount
-
-	err := ws.setBalance(userID, newBalance)
+	releaseLimits, err := ws.reserveLimits(userID, userTier, models.WithdrawTransaction, amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	fee, release, err := ws.fees.Price(userID, userTier, models.WithdrawTransaction, amount, currency, quoteToken)
 	if err != nil {
+		releaseLimits()
+		return nil, err
+	}
+	// The fee is charged on top, so the wallet must cover both.
+	if err := ws.authorizeDebit(userID, amount, amount+fee.Fee, currency, stepUpCode); err != nil {
+		release()
+		releaseLimits()
 		return nil, err
 	}
 
-	txn := ws.createTransaction(userID, userTier, amount, models.WithdrawTransaction)
-	ws.dbWriter <- txn
+	txn := ws.createTransaction(userID, amount, currency, models.WithdrawTransaction, fee)
+	err = ws.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&txn).Error; err != nil {
+			return err
+		}
+		if _, err := ws.adjustBalance(tx, userID, currency, -txn.NetAmount); err != nil {
+			return err
+		}
+		lines := []ledgerServices.Line{
+			ledgerServices.WalletLine(userID, currency, -txn.NetAmount),
+			ledgerServices.ClearingLine(currency, amount),
+		}
+		if fee.Fee != 0 {
+			lines = append(lines, ledgerServices.FeeLine(currency, fee.Fee))
+		}
+		_, err := ws.ledger.Post(tx, string(models.WithdrawTransaction), "wallet withdrawal", &txn.ID, lines...)
+		if err != nil {
+			return err
+		}
+		return ws.publishTransactions(tx, &txn)
+	})
+	if err != nil {
+		release()
+		releaseLimits()
+		return nil, err
+	}
 
+	ws.invalidateBalance(userID, currency)
 	return &txn, nil
 }
 
+// GetLedger returns the postings behind a user's wallet balances. An empty
+// currency includes every wallet.
+func (ws *WalletService) GetLedger(userID uuid.UUID, currency string, limit int) ([]ledgerModels.Posting, error) {
+	return ws.ledger.GetWalletPostings(userID, currency, limit)
+}
+
+// Reconcile compares every stored wallet balance with the sum of its
+// ledger postings and returns the wallets that disagree.
+func (ws *WalletService) Reconcile() ([]BalanceDiscrepancy, error) {
+	var discrepancies []BalanceDiscrepancy
+	err := ws.db.Raw(`
+		SELECT wb.user_id, wb.currency, wb.balance AS wallet_balance, COALESCE(SUM(p.amount), 0) AS ledger_balance
+		FROM wallet_balances wb
+		LEFT JOIN ledger_accounts a ON a.user_id = wb.user_id AND a.currency = wb.currency AND a.kind = ?
+		LEFT JOIN postings p ON p.account_id = a.id
+		GROUP BY wb.user_id, wb.currency, wb.balance
+		HAVING wb.balance <> COALESCE(SUM(p.amount), 0)`, ledgerModels.WalletAccount).
+		Scan(&discrepancies).Error
+	return discrepancies, err
+}
+
+// BackfillOpeningBalances posts an opening entry for wallets that were
+// funded before the ledger existed, so their history starts from a known
+// balance instead of zero.
+func (ws *WalletService) BackfillOpeningBalances() (int, error) {
+	var balances []models.WalletBalance
+	err := ws.db.Raw(`
+		SELECT wb.* FROM wallet_balances wb
+		WHERE wb.balance <> 0 AND NOT EXISTS (
+			SELECT 1 FROM ledger_accounts a
+			WHERE a.user_id = wb.user_id AND a.currency = wb.currency AND a.kind = ?
+		)`, ledgerModels.WalletAccount).
+		Scan(&balances).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, wb := range balances {
+		err := ws.db.Transaction(func(tx *gorm.DB) error {
+			_, err := ws.ledger.Post(tx, "opening_balance", "balance carried over from before the ledger", nil,
+				ledgerServices.WalletLine(wb.UserID, wb.Currency, wb.Balance),
+				ledgerServices.ClearingLine(wb.Currency, -wb.Balance),
+			)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(balances), nil
+}
+
 // Helper Functions
-func (ws *WalletService) balanceKey(userID uuid.UUID) string {
-	return fmt.Sprintf("wallet:balance:%s", userID)
+func (ws *WalletService) balanceKey(userID uuid.UUID, currency string) string {
+	return fmt.Sprintf("wallet:balance:%s:%s", userID, currency)
 }
 
-func (ws *WalletService) setBalance(userID uuid.UUID, balance float64) error {
-	// Store in Redis (optional but good for fast access)
-	data, _ := json.Marshal(balance)
-	if err := ws.redisClient.Set(ctx, ws.balanceKey(userID), data, 0).Err(); err != nil {
-		return err
+// invalidateBalance drops the cached balance once the database write has
+// committed. The next GetBalance reloads it from Postgres, so Redis never
+// holds a value written by a transaction that later rolled back.
+func (ws *WalletService) invalidateBalance(userID uuid.UUID, currency string) {
+	if err := ws.redisClient.Del(ctx, ws.balanceKey(userID, currency)).Err(); err != nil {
+		log.Printf("failed to invalidate %s balance for %s: %v", currency, userID, err)
+	}
+}
+
+// adjustBalance adds delta to a wallet inside tx and returns the new balance.
+// The UPDATE only matches while the result stays non-negative, so the row
+// lock Postgres takes serialises concurrent withdrawals and none of them can
+// spend money another one already took.
+func (ws *WalletService) adjustBalance(tx *gorm.DB, userID uuid.UUID, currency string, delta money.Amount) (money.Amount, error) {
+	// Make sure there is a row to lock for first-time wallets.
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.WalletBalance{UserID: userID, Currency: currency}).Error
+	if err != nil {
+		return 0, err
 	}
 
-	// Store in DB (upsert WalletBalance)
-	walletBalance := models.WalletBalance{
-		UserID:  userID,
-		Balance: balance,
+	var updated []models.WalletBalance
+	err = tx.Raw(`
+		UPDATE wallet_balances
+		SET balance = balance + ?
+		WHERE user_id = ? AND currency = ? AND balance + ? >= 0
+		RETURNING user_id, currency, balance`, delta, userID, currency, delta).
+		Scan(&updated).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(updated) == 0 {
+		return 0, ErrInsufficientBalance
 	}
 
-	err := ws.db.
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "user_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"balance"}),
-		}).
-		Create(&walletBalance).Error
+	return updated[0].Balance, nil
+}
 
+// publishTransactions records an event for each transaction in tx, so
+// consumers hear about exactly the transactions that commit.
+func (ws *WalletService) publishTransactions(tx *gorm.DB, txns ...*models.Transaction) error {
+	for _, txn := range txns {
+		if err := outbox.Enqueue(tx, models.TransactionTopic, txn.UserID.String(), models.NewTransactionEvent(txn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveLimits counts the transaction against the user's tier limits.
+func (ws *WalletService) reserveLimits(userID uuid.UUID, userTier string, txnType models.TransactionType, amount money.Amount, currency string) (func(), error) {
+	if ws.limits == nil {
+		return func() {}, nil
+	}
+	return ws.limits.Reserve(userID, userTier, txnType, amount, currency)
+}
+
+// requireKYC checks the user is verified enough for txnType, for
+// transactions that are not otherwise counted against limits.
+func (ws *WalletService) requireKYC(userID uuid.UUID, txnType models.TransactionType) error {
+	if ws.limits == nil {
+		return nil
+	}
+	_, err := ws.limits.CheckKYC(userID, txnType)
 	return err
 }
 
-func (ws *WalletService) createTransaction(userID uuid.UUID, userTier string, amount float64, txnType models.TransactionType) models.Transaction {
-	feeConfig := models.FeeConfig{TransactionType: "bill_payment", Tier: models.BasicTier, BasePercent: 3.0, Cap: 100.0, Floor: 2.0, PeakStart: time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 17, 0, 0, 0, time.Local), PeakEnd: time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 21, 0, 0, 0, time.Local), PeakSurcharge: 1.0}
-	fee, breakdown := calculateFee(amount, userTier, feeConfig, time.Now())
+// authorizeDebit checks the wallet can cover total and then the second
+// factor for amount. It runs after everything else that can refuse the
+// transaction, because verifying uses up the code: a recovery code for good,
+// a TOTP code for its time step. The balance is checked again under lock
+// when the money moves.
+func (ws *WalletService) authorizeDebit(userID uuid.UUID, amount, total money.Amount, currency string, stepUpCode string) error {
+	var wb models.WalletBalance
+	err := ws.db.Select("balance").First(&wb, "user_id = ? AND currency = ?", userID, currency).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && wb.Balance < total) {
+		return ErrInsufficientBalance
+	}
+	if err != nil {
+		return err
+	}
+	return ws.checkStepUp(userID, amount, currency, stepUpCode)
+}
+
+// checkStepUp requires a valid second factor when amount is over the
+// currency's step-up limit. Everything that sends money out of a wallet
+// checks it: withdrawals, transfers and conversions.
+func (ws *WalletService) checkStepUp(userID uuid.UUID, amount money.Amount, currency string, code string) error {
+	limit, ok := ws.stepUpLimits[currency]
+	if !ok || amount <= limit {
+		return nil
+	}
+	if ws.stepUp == nil {
+		return ErrStepUpUnavailable
+	}
 
-	breakdownJSON, _ := json.Marshal(breakdown)
+	enabled, err := ws.stepUp.Enabled(userID)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor status: %v", err)
+	}
+	if !enabled {
+		return fmt.Errorf("%w: transactions over %s %s need a second factor", ErrStepUpUnavailable, limit, currency)
+	}
+	if code == "" {
+		return ErrStepUpRequired
+	}
+	if err := ws.stepUp.Verify(userID, code); err != nil {
+		return fmt.Errorf("%w: %v", ErrStepUpFailed, err)
+	}
+	return nil
+}
 
+func (ws *WalletService) createTransaction(userID uuid.UUID, amount money.Amount, currency string, txnType models.TransactionType, fee FeeResult) models.Transaction {
 	return models.Transaction{
-		UserID: userID,
-		Amount: amount,
-		Type:   txnType,
+		UserID:    userID,
+		Amount:    amount,
+		Currency:  currency,
+		Type:      txnType,
+		Direction: directionOf(txnType),
 		// CreatedAt: time.Now(),
 		Status:       "pending",
-		Fee:          fee,
-		NetAmount:    amount + fee,
-		FeeBreakdown: breakdownJSON,
+		Fee:          fee.Fee,
+		NetAmount:    netAmount(txnType, amount, fee.Fee),
+		FeeBreakdown: fee.BreakdownJSON(),
+		FeeConfigID:  fee.ConfigID,
 	}
 }
-func (ws *WalletService) GetTransactions(userID uuid.UUID, txnType string, status string, limit int) ([]models.Transaction, error) {
+
+// netAmount is what the transaction moves in the user's wallet: a debit
+// takes the fee on top of the amount, a credit lands with the fee taken
+// out.
+func netAmount(txnType models.TransactionType, amount, fee money.Amount) money.Amount {
+	if directionOf(txnType) == models.Debit {
+		return amount + fee
+	}
+	return amount - fee
+}
+
+func directionOf(txnType models.TransactionType) models.TransactionDirection {
+	if txnType == models.WithdrawTransaction || txnType == models.TierUpgradeTransaction {
+		return models.Debit
+	}
+	return models.Credit
+}
+
+func (ws *WalletService) GetTransactions(userID uuid.UUID, txnType string, status string, currency string, limit int) ([]models.Transaction, error) {
 	var transactions []models.Transaction
 
 	query := ws.db.Where("user_id = ?", userID)
@@ -172,6 +438,9 @@ func (ws *WalletService) GetTransactions(userID uuid.UUID, txnType string, statu
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if currency != "" {
+		query = query.Where("currency = ?", strings.ToUpper(currency))
+	}
 
 	if limit == 0 {
 		limit = 50
@@ -180,41 +449,3 @@ func (ws *WalletService) GetTransactions(userID uuid.UUID, txnType string, statu
 	err := query.Limit(limit).Order("created_at desc").Preload("User").Find(&transactions).Error
 	return transactions, err
 }
-
-func calculateFee(amount float64, userTier string, config models.FeeConfig, now time.Time) (fee float64, breakdown map[string]interface{}) {
-	// Base fee
-	var basePercent float64
-	if userTier == "Premium" {
-		basePercent = 1
-
-	} else {
-		basePercent = 3
-	}
-	fee = amount * float64(basePercent) / 100
-
-	// Time-based surcharge
-	if now.After(config.PeakStart) && now.Before(config.PeakEnd) {
-		surcharge := amount * config.PeakSurcharge / 100
-		fee += surcharge
-		breakdown = map[string]interface{}{
-			"base_fee":       fee - surcharge,
-			"peak_surcharge": surcharge,
-		}
-	} else {
-		breakdown = map[string]interface{}{
-			"base_fee":       fee,
-			"peak_surcharge": 0,
-		}
-	}
-
-	// Enforce floor and cap
-	if fee < config.Floor {
-		fee = config.Floor
-	}
-	if fee > config.Cap {
-		fee = config.Cap
-	}
-
-	breakdown["total_fee"] = fee
-	return fee, breakdown
-}
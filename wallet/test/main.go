@@ -0,0 +1,134 @@
+package main
+
+// Fires a burst of parallel withdrawals at a single wallet and checks that the
+// balance never goes negative and still matches its ledger. Needs the same
+// Postgres and Redis environment variables as cmd/main.go:
+//
+//	go run ./wallet/test -workers 2000 -deposit 500 -amount 1
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+
+	userModel "github.com/nazrawigedion123/wallet-backend/auth/models"
+	ledgerService "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	db "github.com/nazrawigedion123/wallet-backend/utils"
+	"github.com/nazrawigedion123/wallet-backend/wallet/models"
+	walletService "github.com/nazrawigedion123/wallet-backend/wallet/services"
+)
+
+func main() {
+	workers := flag.Int("workers", 2000, "number of concurrent withdrawals")
+	depositFlag := flag.String("deposit", "500.00", "starting balance")
+	amountFlag := flag.String("amount", "1.00", "amount of each withdrawal")
+	flag.Parse()
+
+	deposit, err := money.Parse(*depositFlag)
+	if err != nil {
+		log.Fatalf("invalid deposit: %v", err)
+	}
+	amount, err := money.Parse(*amountFlag)
+	if err != nil {
+		log.Fatalf("invalid amount: %v", err)
+	}
+
+	_ = godotenv.Load()
+	if err := db.InitDB(); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.CloseConnections()
+	if err := db.InitRedis(); err != nil {
+		log.Fatalf("failed to connect to redis: %v", err)
+	}
+
+	ledgerSvc := ledgerService.NewLedgerService(db.DB)
+	fees := walletService.NewFeeService(db.DB, db.RedisClient, os.Getenv("JWT_SECRET"), time.Minute)
+	if err := fees.Reload(); err != nil {
+		log.Fatalf("failed to load fee configs: %v", err)
+	}
+	ws := walletService.NewWalletService(db.DB, db.RedisClient, ledgerSvc, fees, nil, nil, nil)
+
+	user := userModel.User{
+		ID:       uuid.New(),
+		Email:    fmt.Sprintf("race-%s@example.com", uuid.NewString()),
+		Password: "-",
+	}
+	if err := db.DB.Create(&user).Error; err != nil {
+		log.Fatalf("failed to create user: %v", err)
+	}
+
+	// Fees come out of the deposit and on top of each withdrawal, so the
+	// expected balance is built from what the transactions actually moved.
+	funding, err := ws.Deposit(user.ID, string(user.Tier), deposit, money.DefaultCurrency, "")
+	if err != nil {
+		log.Fatalf("failed to fund wallet: %v", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		withdrawn money.Amount
+		succeeded int64
+		rejected  int64
+		failed    int64
+	)
+	start := make(chan struct{})
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			txn, err := ws.Withdraw(user.ID, string(user.Tier), amount, money.DefaultCurrency, "", "")
+			switch {
+			case err == nil:
+				atomic.AddInt64(&succeeded, 1)
+				mu.Lock()
+				withdrawn += txn.NetAmount
+				mu.Unlock()
+			case errors.Is(err, walletService.ErrInsufficientBalance):
+				atomic.AddInt64(&rejected, 1)
+			default:
+				atomic.AddInt64(&failed, 1)
+				log.Printf("withdraw failed: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	var wb models.WalletBalance
+	if err := db.DB.First(&wb, "user_id = ? AND currency = ?", user.ID, money.DefaultCurrency).Error; err != nil {
+		log.Fatalf("failed to load balance: %v", err)
+	}
+	ledgerBalance, err := ledgerSvc.WalletBalance(user.ID, money.DefaultCurrency)
+	if err != nil {
+		log.Fatalf("failed to load ledger balance: %v", err)
+	}
+
+	expected := funding.NetAmount - withdrawn
+	fmt.Printf("succeeded=%d rejected=%d failed=%d balance=%s ledger=%s expected=%s\n",
+		succeeded, rejected, failed, wb.Balance, ledgerBalance, expected)
+
+	switch {
+	case wb.Balance < 0:
+		fmt.Println("FAIL: balance went negative")
+		os.Exit(1)
+	case wb.Balance != expected:
+		fmt.Println("FAIL: balance does not match successful withdrawals")
+		os.Exit(1)
+	case wb.Balance != ledgerBalance:
+		fmt.Println("FAIL: balance does not match ledger")
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
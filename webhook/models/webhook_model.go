@@ -5,19 +5,21 @@ package models
 import (
 	"time"
 
+	"github.com/nazrawigedion123/wallet-backend/money"
 	"github.com/nazrawigedion123/wallet-backend/webhook/utils"
 	"gorm.io/gorm"
 )
 
 type WebhookEvent struct {
-	ID        uint        `gorm:"primaryKey"`
-	EventID   string      `gorm:"uniqueIndex;not null"` // For idempotency
-	Type      string      `gorm:"not null"`             // bill_payment, wallet_credit, etc.
-	UserID    string      `gorm:"index;not null"`
-	Amount    float64     `gorm:"not null"`
-	Timestamp time.Time   `gorm:"not null"`
-	Metadata  utils.JSONB `gorm:"type:jsonb"`        // Custom type for map[string]string
-	Status    string      `gorm:"default:'pending'"` // processed, failed, etc.
+	ID        uint         `gorm:"primaryKey"`
+	EventID   string       `gorm:"uniqueIndex;not null"` // For idempotency
+	Type      string       `gorm:"not null"`             // bill_payment, wallet_credit, etc.
+	UserID    string       `gorm:"index;not null"`
+	Amount    money.Amount `gorm:"not null"`
+	Currency  string       `gorm:"type:varchar(3);not null;default:'USD'"`
+	Timestamp time.Time    `gorm:"not null"`
+	Metadata  utils.JSONB  `gorm:"type:jsonb"`        // Custom type for map[string]string
+	Status    string       `gorm:"default:'pending'"` // processed, failed, etc.
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -27,13 +29,14 @@ type Metadata struct {
 }
 
 type IncomingWebhook struct {
-	EventID   string    `json:"event_id" validate:"required"`
-	Type      string    `json:"type" validate:"required"`
-	UserID    string    `json:"user_id" validate:"required"`
-	Amount    float64   `json:"amount" validate:"required"`
-	Timestamp time.Time `json:"timestamp"`
-	Metadata  Metadata  `json:"metadata"`
-	Status    string    `json:"status" validate:"required"`
+	EventID   string       `json:"event_id" validate:"required"`
+	Type      string       `json:"type" validate:"required"`
+	UserID    string       `json:"user_id" validate:"required"`
+	Amount    money.Amount `json:"amount" validate:"required"`
+	Currency  string       `json:"currency"` // defaults to USD
+	Timestamp time.Time    `json:"timestamp"`
+	Metadata  Metadata     `json:"metadata"`
+	Status    string       `json:"status" validate:"required"`
 }
 
 // type Metadata struct {
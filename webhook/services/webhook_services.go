@@ -5,48 +5,73 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
+	ledgerModels "github.com/nazrawigedion123/wallet-backend/ledger/models"
+	ledgerServices "github.com/nazrawigedion123/wallet-backend/ledger/services"
+	"github.com/nazrawigedion123/wallet-backend/money"
+	"github.com/nazrawigedion123/wallet-backend/outbox"
 	transactionModels "github.com/nazrawigedion123/wallet-backend/wallet/models"
 	"github.com/nazrawigedion123/wallet-backend/webhook/models"
 )
 
 type WebhookService struct {
-	Redis *redis.Client
-	DB    *gorm.DB
+	Redis  *redis.Client
+	DB     *gorm.DB
+	Ledger *ledgerServices.LedgerService
 }
 
-func NewWebhookService(redisClient *redis.Client, db *gorm.DB) *WebhookService {
+func NewWebhookService(redisClient *redis.Client, db *gorm.DB, ledger *ledgerServices.LedgerService) *WebhookService {
 	return &WebhookService{
-		Redis: redisClient,
-		DB:    db,
+		Redis:  redisClient,
+		DB:     db,
+		Ledger: ledger,
 	}
 }
 
 func (s *WebhookService) ProcessWebhook(ctx context.Context, payload models.IncomingWebhook) error {
 	idempotencyKey := fmt.Sprintf("webhook:event:%s", payload.EventID)
 
-	// Idempotency check
-	exists, err := s.Redis.Get(ctx, idempotencyKey).Result()
-	if err == nil && exists == "1" {
+	var err error
+	payload.Currency, err = money.NormalizeCurrency(payload.Currency)
+	if err != nil {
+		return err
+	}
+
+	// Idempotency check: claim the event so a concurrent delivery of it is
+	// refused. The claim is dropped if processing fails, so the provider's
+	// retry is processed rather than taken for a duplicate.
+	claimed, err := s.Redis.SetNX(ctx, idempotencyKey, "1", 24*time.Hour).Result()
+	if err != nil {
+		return fmt.Errorf("failed to claim webhook event: %v", err)
+	}
+	if !claimed {
 		return errors.New("duplicate webhook event")
 	}
 
-	// Persist webhook event
-	if err := s.saveWebhookEvent(ctx, payload); err != nil {
+	if err := s.dispatch(ctx, payload); err != nil {
+		if delErr := s.Redis.Del(ctx, idempotencyKey).Err(); delErr != nil {
+			log.Printf("failed to release webhook event %s: %v", payload.EventID, delErr)
+		}
 		return err
 	}
 
-	// Set idempotency key and payload in Redis
+	// Record the event only once it has been processed. It has taken
+	// effect by now, so failing to record it is not the provider's problem.
+	if err := s.saveWebhookEvent(ctx, payload); err != nil {
+		log.Printf("webhook event %s processed but not recorded: %v", payload.EventID, err)
+	}
 	if err := s.cacheWebhookEvent(ctx, idempotencyKey, payload); err != nil {
-		return err
+		log.Printf("webhook event %s processed but not cached: %v", payload.EventID, err)
 	}
+	return nil
+}
 
-	// Dispatch event
+func (s *WebhookService) dispatch(ctx context.Context, payload models.IncomingWebhook) error {
 	switch payload.Type {
 	case "wallet_credit":
 		return s.handleWalletCredit(ctx, payload)
@@ -61,10 +86,11 @@ func (s *WebhookService) ProcessWebhook(ctx context.Context, payload models.Inco
 
 func (s *WebhookService) saveWebhookEvent(ctx context.Context, payload models.IncomingWebhook) error {
 	event := models.WebhookEvent{
-		EventID: payload.EventID,
-		Type:    payload.Type,
-		UserID:  payload.UserID,
-		Amount:  payload.Amount,
+		EventID:  payload.EventID,
+		Type:     payload.Type,
+		UserID:   payload.UserID,
+		Amount:   payload.Amount,
+		Currency: payload.Currency,
 	}
 	if err := s.DB.WithContext(ctx).Create(&event).Error; err != nil {
 		return fmt.Errorf("failed to save webhook event: %v", err)
@@ -89,135 +115,63 @@ func (s *WebhookService) cacheWebhookEvent(ctx context.Context, key string, payl
 }
 
 func (s *WebhookService) handleWalletCredit(ctx context.Context, payload models.IncomingWebhook) error {
-	tx := s.DB.Begin()
-	if tx.Error != nil {
-		return fmt.Errorf("failed to begin DB transaction: %v", tx.Error)
-	}
-
-	// 1. Try to update the matching transaction first
-	updateTx := &gorm.DB{} // declare updateTx to avoid undefined error
-
-	if payload.Status == string(transactionModels.StatusSuccess) || payload.Status == string(transactionModels.StatusFailed) {
-		updateTx = tx.Exec(`
-		UPDATE transactions
-		SET status = ?
-		WHERE ctid IN (
-			SELECT ctid FROM transactions
-			WHERE user_id = ? AND amount = ? AND type = ? AND status = ?
-			ORDER BY created_at ASC
-			LIMIT 1
-		)
-	`, payload.Status, payload.UserID, payload.Amount, "deposit", transactionModels.StatusPending)
-	} else {
-		return fmt.Errorf("invalid type statys ")
-
-	}
-
-	if updateTx.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to update transaction status: %v", updateTx.Error)
-	}
-	if updateTx.RowsAffected == 0 {
-		tx.Rollback()
-		return fmt.Errorf("no matching pending transaction found to update")
-	}
-
-	// 2. Update wallet balance
-	res := tx.Exec(`
-		UPDATE wallet_balances
-		SET balance = balance + ?
-		WHERE user_id = ?`, payload.Amount, payload.UserID)
+	return s.settleTransaction(ctx, payload, transactionModels.DepositTransaction)
+}
 
-	if res.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("credit failed: %v", res.Error)
-	}
-	if res.RowsAffected == 0 {
-		tx.Rollback()
-		return fmt.Errorf("user wallet not found")
-	}
+func (s *WebhookService) handleWalletDebit(ctx context.Context, payload models.IncomingWebhook) error {
+	return s.settleTransaction(ctx, payload, transactionModels.WithdrawTransaction)
+}
 
-	// 3. Commit
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+// settleTransaction records the provider's verdict on a pending deposit or
+// withdrawal. The wallet and ledger already moved when the transaction was
+// created, so success only marks it done; failure marks it failed and
+// reverses what it moved.
+func (s *WebhookService) settleTransaction(ctx context.Context, payload models.IncomingWebhook, txnType transactionModels.TransactionType) error {
+	status := transactionModels.TransactionStatus(payload.Status)
+	if status != transactionModels.StatusSuccess && status != transactionModels.StatusFailed {
+		return fmt.Errorf("invalid transaction status %q", payload.Status)
 	}
 
-	// 4. Update Redis balance
-	go func() {
-		pasrsedUUID, err := uuid.Parse(payload.UserID)
-		if err != nil {
-			fmt.Println("error parsing uid", err.Error())
-		}
-		_ = s.updateRedisBalance(pasrsedUUID)
-	}()
-
-	// 5. Publish Redis event
-	s.Redis.Publish(ctx, "wallet:credit", fmt.Sprintf("user:%s:amount:%f", payload.UserID, payload.Amount))
-	return nil
-}
-
-func (s *WebhookService) handleWalletDebit(ctx context.Context, payload models.IncomingWebhook) error {
-	tx := s.DB.Begin()
+	tx := s.DB.WithContext(ctx).Begin()
 	if tx.Error != nil {
 		return fmt.Errorf("failed to begin DB transaction: %v", tx.Error)
 	}
 
-	// 1. Check balance
-	var balance float64
+	// 1. Settle the oldest matching pending transaction
+	var transactionID uint
 	err := tx.Raw(`
-		SELECT balance FROM wallet_balances
-		WHERE user_id = ?`, payload.UserID).Scan(&balance).Error
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("balance check failed: %v", err)
-	}
-	if balance < payload.Amount {
-		tx.Rollback()
-		return fmt.Errorf("insufficient balance")
-	}
-
-	// 2. Try to update the transaction first
-	updateTx := &gorm.DB{}
-	// 1. Update wallet balance
-	
-	if payload.Status == string(transactionModels.StatusSuccess) || payload.Status == string(transactionModels.StatusFailed) {
-		updateTx = tx.Exec(`
 		UPDATE transactions
 		SET status = ?
 		WHERE ctid IN (
 			SELECT ctid FROM transactions
-			WHERE user_id = ? AND amount = ? AND type = ? AND status = ?
+			WHERE user_id = ? AND amount = ? AND currency = ? AND type = ? AND status = ?
 			ORDER BY created_at ASC
 			LIMIT 1
+			FOR UPDATE
 		)
-	`, payload.Status, payload.UserID, payload.Amount, "withdraw", transactionModels.StatusPending)
-
-	} else {
-		return fmt.Errorf("invalid payload type")
-	}
-
-	if updateTx.Error != nil {
+		RETURNING id
+	`, status, payload.UserID, payload.Amount, payload.Currency, txnType, transactionModels.StatusPending).Scan(&transactionID).Error
+	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to update transaction status: %v", updateTx.Error)
+		return fmt.Errorf("failed to update transaction status: %v", err)
 	}
-	if updateTx.RowsAffected == 0 {
+	if transactionID == 0 {
 		tx.Rollback()
-		return fmt.Errorf("no matching pending withdrawal transaction found to update")
+		return fmt.Errorf("no matching pending %s transaction found to update", txnType)
 	}
 
-	// 3. Deduct from wallet
-	res := tx.Exec(`
-		UPDATE wallet_balances
-		SET balance = balance - ?
-		WHERE user_id = ?`, payload.Amount, payload.UserID)
-
-	if res.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("debit failed: %v", res.Error)
+	// 2. Undo a failed transaction in the ledger and the wallet
+	if status == transactionModels.StatusFailed {
+		if err := s.reverseTransaction(tx, payload, transactionID); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	if res.RowsAffected == 0 {
+
+	// 3. Publish the status change once it commits
+	if err := s.publishTransaction(tx, transactionID); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("user wallet not found")
+		return err
 	}
 
 	// 4. Commit
@@ -225,31 +179,60 @@ func (s *WebhookService) handleWalletDebit(ctx context.Context, payload models.I
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	// 5. Update Redis balance
-	go func() {
-		pasrsedUUID, err := uuid.Parse(payload.UserID)
-		if err != nil {
-			fmt.Println("error parsing uid", err.Error())
-		}
-		_ = s.updateRedisBalance(pasrsedUUID)
-	}()
-
-	// 6. Publish Redis event
-	s.Redis.Publish(ctx, "wallet:debit", fmt.Sprintf("user:%s:amount:%f", payload.UserID, payload.Amount))
+	// 5. Drop the cached balance so the next read loads the committed one
+	if status == transactionModels.StatusFailed {
+		s.invalidateBalance(payload.UserID, payload.Currency)
+	}
 	return nil
 }
 
-func (s *WebhookService) updateRedisBalance(userID uuid.UUID) error {
-	var balance float64
-	err := s.DB.
-		Raw("SELECT balance FROM wallet_balances WHERE user_id = ?", userID).
-		Scan(&balance).Error
+// reverseTransaction posts the opposite of every ledger entry behind the
+// transaction and moves the wallet balances back to match. A failed
+// deposit the user has already spent cannot be taken back, so it is an
+// error rather than a negative balance.
+func (s *WebhookService) reverseTransaction(tx *gorm.DB, payload models.IncomingWebhook, transactionID uint) error {
+	entry, err := s.Ledger.Reverse(tx, transactionID, "webhook:"+payload.EventID, payload.Type+" failed")
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to reverse ledger entry: %v", err)
 	}
 
-	data, _ := json.Marshal(balance)
-	return s.Redis.Set(context.Background(), fmt.Sprintf("wallet:balance:%s", userID), data, 0).Err()
+	for _, posting := range entry.Postings {
+		if posting.Account.Kind != ledgerModels.WalletAccount || posting.Account.UserID == nil {
+			continue
+		}
+		res := tx.Exec(`
+			UPDATE wallet_balances
+			SET balance = balance + ?
+			WHERE user_id = ? AND currency = ? AND balance + ? >= 0`,
+			posting.Amount, *posting.Account.UserID, posting.Account.Currency, posting.Amount)
+		if res.Error != nil {
+			return fmt.Errorf("failed to reverse balance: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("insufficient balance to reverse failed %s", payload.Type)
+		}
+	}
+	return nil
+}
+
+// publishTransaction records the transaction's new status in the outbox,
+// inside tx.
+func (s *WebhookService) publishTransaction(tx *gorm.DB, transactionID uint) error {
+	var txn transactionModels.Transaction
+	if err := tx.First(&txn, transactionID).Error; err != nil {
+		return fmt.Errorf("failed to load transaction: %v", err)
+	}
+	return outbox.Enqueue(tx, transactionModels.TransactionTopic, txn.UserID.String(), transactionModels.NewTransactionEvent(&txn))
+}
+
+// invalidateBalance drops the cached balance after a commit. It runs
+// before the webhook is acknowledged rather than in a detached goroutine,
+// so shutdown can never leave a stale balance cached.
+func (s *WebhookService) invalidateBalance(userID string, currency string) {
+	key := fmt.Sprintf("wallet:balance:%s:%s", userID, currency)
+	if err := s.Redis.Del(context.Background(), key).Err(); err != nil {
+		log.Printf("failed to invalidate %s balance for %s: %v", currency, userID, err)
+	}
 }
 
 func (s *WebhookService) handleBillPayment(ctx context.Context, payload models.IncomingWebhook) error {